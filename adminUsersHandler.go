@@ -0,0 +1,309 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Account actions admins take, recorded in the moderation log next to the
+// moderators' actions.
+const (
+	adminForcePasswordReset = "force_password_reset"
+	adminRevokeSessions = "revoke_sessions"
+	adminGrantChirpyRed = "grant_chirpy_red"
+	adminRevokeChirpyRed = "revoke_chirpy_red"
+	adminDeleteUser = "delete_user"
+)
+
+// logAdminAction records action in the moderation log and the audit log.
+func (a *apiConfig) logAdminAction(q *database.Queries, r *http.Request, admin database.User, action string, userID uuid.UUID, note string) error {
+	_, err := q.AppendModerationLog(r.Context(), database.AppendModerationLogParams{
+		ModeratorID: uuid.NullUUID{UUID: admin.ID, Valid: true},
+		Action: action,
+		TargetUserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Note: note,
+	})
+	if err != nil {
+		return err
+	}
+	event := auditEvent{Event: "admin." + action, ActorID: admin.ID, UserID: userID}
+	if note != "" {
+		event.Metadata = map[string]any{"note": note}
+	}
+	return a.appendAudit(q, r, event)
+}
+
+type adminUserResponse struct {
+	Id uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Email string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
+	Role string `json:"role"`
+	IsChirpyRed bool `json:"is_chirpy_red"`
+	MFAEnabled bool `json:"mfa_enabled"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	ShadowBanned bool `json:"shadow_banned"`
+}
+
+func toAdminUserResponse(user database.User) adminUserResponse {
+	userData := adminUserResponse{
+		Id: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role: user.Role,
+		IsChirpyRed: user.IsChirpyRed,
+		MFAEnabled: user.TotpEnabledAt.Valid,
+		ShadowBanned: user.ShadowBanned,
+	}
+	if isSuspended(user) {
+		userData.SuspendedUntil = &user.SuspendedUntil.Time
+	}
+	return userData
+}
+
+// escapeLike makes s match itself in an ILIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// searchUsers finds accounts whose email contains the "q" query parameter.
+// Users have no usernames, the email is what names an account.
+func (a *apiConfig) searchUsers(w http.ResponseWriter, r *http.Request, admin database.User) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			respondWithError(w, http.StatusBadRequest, "Limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	users, err := a.dbQueries.SearchUsers(r.Context(), database.SearchUsersParams{
+		Pattern: "%" + escapeLike(strings.TrimSpace(r.URL.Query().Get("q"))) + "%",
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	usersData := []adminUserResponse{}
+	for _, user := range users {
+		usersData = append(usersData, toAdminUserResponse(user))
+	}
+	respondWithJSON(w, http.StatusOK, usersData)
+}
+
+// adminUser loads the user named in the path. It writes the error response
+// itself.
+func (a *apiConfig) adminUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return database.User{}, false
+	}
+	user, err := a.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user on database")
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (a *apiConfig) getAdminUser(w http.ResponseWriter, r *http.Request, admin database.User) {
+	user, ok := a.adminUser(w, r)
+	if !ok {
+		return
+	}
+	sessions, err := a.dbQueries.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	chirps, err := a.dbQueries.CountChirpsByAuthor(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type chirpCounts struct {
+		Total int64 `json:"total"`
+		Hidden int64 `json:"hidden"`
+	}
+	type detailsResponse struct {
+		adminUserResponse
+		Sessions []sessionResponse `json:"sessions"`
+		Chirps chirpCounts `json:"chirps"`
+	}
+	respondWithJSON(w, http.StatusOK, detailsResponse{
+		adminUserResponse: toAdminUserResponse(user),
+		Sessions: toSessionResponses(sessions),
+		Chirps: chirpCounts{Total: chirps.Total, Hidden: chirps.Hidden},
+	})
+}
+
+// forcePasswordReset takes every way in away from the user with
+// wipeCredentials and mails them a reset token, for accounts that look taken
+// over.
+func (a *apiConfig) forcePasswordReset(w http.ResponseWriter, r *http.Request, admin database.User) {
+	user, ok := a.adminUser(w, r)
+	if !ok {
+		return
+	}
+	unusableHash, err := auth.HashPassword(uuid.NewString(), a.passwordParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		if err := wipeCredentials(r.Context(), q, user.ID, unusableHash); err != nil {
+			return err
+		}
+		return a.logAdminAction(q, r, admin, adminForcePasswordReset, user.ID, "")
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := a.startPasswordReset(r.Context(), user, true); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "The password was reset but the email couldn't be sent: " + err.Error())
+		return
+	}
+
+	log.Printf("Admin %v forced a password reset of user %v", admin.ID, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeUserSessions logs the user out everywhere, like revokeAllSessions
+// does for themselves.
+func (a *apiConfig) revokeUserSessions(w http.ResponseWriter, r *http.Request, admin database.User) {
+	user, ok := a.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		revoked, err := logOutEverywhere(r.Context(), q, user.ID)
+		if err != nil {
+			return err
+		}
+		return a.logAdminAction(q, r, admin, adminRevokeSessions, user.ID, fmt.Sprintf("%d refresh tokens revoked", revoked))
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Admin %v revoked every session of user %v", admin.ID, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setUserChirpyRed grants or takes away Chirpy Red by hand, e.g. after a
+// refund Polka didn't tell us about.
+func (a *apiConfig) setUserChirpyRed(w http.ResponseWriter, r *http.Request, admin database.User) {
+	user, ok := a.adminUser(w, r)
+	if !ok {
+		return
+	}
+	type redInput struct {
+		IsChirpyRed *bool `json:"is_chirpy_red"`
+	}
+	input := redInput{}
+	decodeInput(w, r, &input)
+	if input.IsChirpyRed == nil {
+		respondWithError(w, http.StatusBadRequest, "is_chirpy_red is required")
+		return
+	}
+
+	action := adminRevokeChirpyRed
+	if *input.IsChirpyRed {
+		action = adminGrantChirpyRed
+	}
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		changed, err := q.SetChirpyRed(r.Context(), database.SetChirpyRedParams{ID: user.ID, IsChirpyRed: *input.IsChirpyRed})
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			return errNoChange
+		}
+		return a.logAdminAction(q, r, admin, action, user.ID, "")
+	})
+	if errors.Is(err, errNoChange) {
+		respondWithError(w, http.StatusConflict, "The user is already in that state")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Admin %v: %s for user %v", admin.ID, action, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAdminUser deletes one account and everything it owns. The log keeps
+// its email, since the account itself is gone.
+func (a *apiConfig) deleteAdminUser(w http.ResponseWriter, r *http.Request, admin database.User) {
+	user, ok := a.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockRole(r.Context(), roleAdmin); err != nil {
+			return err
+		}
+		current, err := q.GetUserByID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		if current.Role == roleAdmin {
+			admins, err := q.CountUsersWithRole(r.Context(), roleAdmin)
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errLastAdmin
+			}
+		}
+		if _, err := q.DeleteUser(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return a.logAdminAction(q, r, admin, adminDeleteUser, user.ID, current.Email)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user on database")
+		return
+	}
+	if errors.Is(err, errLastAdmin) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Admin %v deleted user %v", admin.ID, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
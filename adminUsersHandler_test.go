@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestEscapeLike(t *testing.T) {
+	cases := []struct {
+		in string
+		want string
+	}{
+		{in: "walt@breakingbad.com", want: "walt@breakingbad.com"},
+		{in: "100%", want: `100\%`},
+		{in: "saul_goodman", want: `saul\_goodman`},
+		{in: `back\slash`, want: `back\\slash`},
+	}
+	for _, c := range cases {
+		if got := escapeLike(c.in); got != c.want {
+			t.Errorf("escapeLike(%q) = %q, expected %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestAdminUserResponseSuspension(t *testing.T) {
+	user := database.User{}
+	user.SuspendedUntil.Valid = true
+	user.SuspendedUntil.Time = time.Now().UTC().Add(-time.Hour)
+	if toAdminUserResponse(user).SuspendedUntil != nil {
+		t.Errorf("a suspension that ended shouldn't be shown")
+		return
+	}
+
+	user.SuspendedUntil.Time = time.Now().UTC().Add(time.Hour)
+	if toAdminUserResponse(user).SuspendedUntil == nil {
+		t.Errorf("expected the current suspension to be shown")
+	}
+}
+
+// credentialsLeft counts the ways into the account of userID other than its
+// password: two-factor authentication, recovery codes, passkeys, personal
+// access tokens, linked identities and login links.
+func (s *testServer) credentialsLeft(userID uuid.UUID) (int, error) {
+	left := 0
+	err := s.api.db.QueryRow(`SELECT
+		(SELECT count(*) FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL) +
+		(SELECT count(*) FROM recovery_codes WHERE user_id = $1) +
+		(SELECT count(*) FROM webauthn_credentials WHERE user_id = $1) +
+		(SELECT count(*) FROM personal_access_tokens WHERE user_id = $1) +
+		(SELECT count(*) FROM user_identities WHERE user_id = $1) +
+		(SELECT count(*) FROM magic_links WHERE user_id = $1)`, userID).Scan(&left)
+	return left, err
+}
+
+func TestForcePasswordResetWipesCredentials(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+	ctx := context.Background()
+
+	gus, err := s.signUp("gus@lospolloshermanos.com", "i hide in plain sight", "admin")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	// Every way in someone who got hold of the account could have set up.
+	if _, err := s.enableTOTP(walt.Token); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	w := s.request("POST", "/api/tokens", walt.Token, map[string]any{"name": "backdoor", "scopes": []string{auth.ScopeProfileRead}})
+	if w.Code != http.StatusCreated {
+		t.Errorf("couldn't create a token: %d %s", w.Code, w.Body.String())
+		return
+	}
+	browser, link, err := s.requestMagicLink("walt@breakingbad.com")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	_, err = s.api.dbQueries.CreateWebAuthnCredential(ctx, database.CreateWebAuthnCredentialParams{
+		UserID: walt.Id,
+		CredentialID: []byte("backdoor"),
+		Credential: json.RawMessage("{}"),
+		Name: "Backdoor",
+	})
+	if err != nil {
+		t.Errorf("couldn't add a passkey: %v", err)
+		return
+	}
+	err = s.api.dbQueries.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Issuer: "https://accounts.example.com",
+		Subject: "backdoor",
+		UserID: walt.Id,
+		Email: "walt@breakingbad.com",
+	})
+	if err != nil {
+		t.Errorf("couldn't link an identity: %v", err)
+		return
+	}
+
+	w = s.request("POST", "/admin/users/" + walt.Id.String() + "/password-reset", gus.Token, nil)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	left, err := s.credentialsLeft(walt.Id)
+	if err != nil {
+		t.Errorf("couldn't count the credentials: %v", err)
+		return
+	}
+	if left != 0 {
+		t.Errorf("expected every credential to be removed, %d are left", left)
+		return
+	}
+	if w := s.confirmMagicLink(browser, link); w.Code != http.StatusBadRequest {
+		t.Errorf("expected the login link to stop working, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if _, err := s.login("walt@breakingbad.com", "say my name heisenberg"); err == nil {
+		t.Errorf("the old password still works")
+		return
+	}
+	if token := s.mailedToken("walt@breakingbad.com", auth.PasswordResetTokenPrefix); token == "" {
+		t.Errorf("expected a reset token to be mailed")
+	}
+}
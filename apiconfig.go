@@ -1,23 +1,74 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/NHMosko/chirpy/internal/auth"
 	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/NHMosko/chirpy/internal/moderation"
+	"github.com/NHMosko/chirpy/internal/oidc"
+	"github.com/NHMosko/chirpy/internal/passkey"
+	"github.com/NHMosko/chirpy/internal/throttle"
+	"github.com/NHMosko/chirpy/internal/validate"
 	"github.com/google/uuid"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db *sql.DB
 	dbQueries *database.Queries
 	platform string
-	jwtSecret string
+	jwtKeys *auth.KeySet
+	tokenConfig auth.TokenConfig
+	passkeys *passkey.Service
+	// oidc is the identity provider users can log in with, nil when none
+	// is configured.
+	oidc *oidc.Provider
+	mailer mailer.Mailer
+	// magicLinkURL is the frontend page login links point to.
+	magicLinkURL *url.URL
 	polkaKey string
+	trustProxy bool
+	accountThrottle throttle.Policy
+	ipThrottle throttle.Policy
+	// dummyPasswordHash is checked against when no account has the email,
+	// so an unknown email takes as long as a wrong password.
+	dummyPasswordHash string
+	// verifiedEmailRequired keeps users who haven't verified their email
+	// from chirping and from being upgraded to Chirpy Red.
+	verifiedEmailRequired bool
+	chirpPolicy validate.ChirpPolicy
+	passwordPolicy validate.PasswordPolicy
+	passwordParams auth.PasswordParams
+	bannedTerms *moderation.Cache
+	// background tracks the work started by inBackground.
+	background sync.WaitGroup
+}
+
+// withTx runs fn inside a database transaction, committing when it returns
+// nil and rolling back otherwise.
+func (a *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(a.dbQueries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (a *apiConfig) middleMetricsInc(next http.Handler) http.HandlerFunc {
@@ -28,7 +79,7 @@ func (a *apiConfig) middleMetricsInc(next http.Handler) http.HandlerFunc {
 }
 
 
-func (a *apiConfig) getMetrics(w http.ResponseWriter, r *http.Request) {
+func (a *apiConfig) getMetrics(w http.ResponseWriter, r *http.Request, user database.User) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `<html>
@@ -39,7 +90,168 @@ func (a *apiConfig) getMetrics(w http.ResponseWriter, r *http.Request) {
 </html>`, a.fileserverHits.Load())
 }
 
-func (a *apiConfig) handleReset(w http.ResponseWriter, r *http.Request) {
+// checkPassword applies the password policy for an account with email. It
+// writes the error response itself.
+func (a *apiConfig) checkPassword(w http.ResponseWriter, password, email string) bool {
+	err := a.passwordPolicy.Password(password, email)
+	if err == nil {
+		return true
+	}
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		respondWithValidationError(w, err)
+	} else {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+	return false
+}
+
+// authedHandler handles requests made on behalf of a signed in user.
+type authedHandler func(w http.ResponseWriter, r *http.Request, user database.User)
+
+// requireAuth lets a request through to next only with a valid access token
+// or personal access token. Restricted tokens must carry scope; scope ""
+// means the handler manages the account itself and only takes unrestricted
+// tokens from a login.
+func (a *apiConfig) requireAuth(scope string, next authedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.authenticateUser(w, r, scope)
+		if !ok {
+			return
+		}
+		next(w, r, user)
+	}
+}
+
+// authenticateUser validates the bearer token and loads the user it belongs
+// to, refusing tokens of suspended accounts and tokens without scope. It
+// writes the error response itself.
+func (a *apiConfig) authenticateUser(w http.ResponseWriter, r *http.Request, scope string) (database.User, bool) {
+	user, refuse := a.authenticate(r, scope)
+	if refuse != nil {
+		refuse(w)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// authenticate is authenticateUser without the response: when the request
+// can't go through, it returns what to answer instead of the user.
+func (a *apiConfig) authenticate(r *http.Request, scope string) (database.User, func(w http.ResponseWriter)) {
+	unauthorized := func(err error) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+		}
+	}
+	bearer, err := auth.ParseBearerToken(r.Header)
+	if err != nil {
+		return database.User{}, unauthorized(err)
+	}
+
+	var user database.User
+	var granted []string
+	switch bearer.Kind {
+	case auth.TokenAccess:
+		var token auth.AccessToken
+		token, err = auth.ValidateJWT(bearer.Value, a.jwtKeys, a.tokenConfig, func(userID uuid.UUID) (int32, error) {
+			user, err = a.dbQueries.GetUserByID(r.Context(), userID)
+			if err != nil {
+				return 0, fmt.Errorf("User no longer exists")
+			}
+			return user.TokenVersion, nil
+		})
+		granted = token.Scope
+		if err == nil && token.SessionID != uuid.Nil {
+			err = a.checkSession(r.Context(), token.SessionID)
+		}
+		if err == nil && token.ClientID != "" {
+			err = a.checkClient(r.Context(), token.ClientID)
+		}
+	case auth.TokenPersonal:
+		var pat database.PersonalAccessToken
+		pat, err = a.checkPersonalAccessToken(r.Context(), bearer.Value)
+		if err == nil {
+			user, err = a.dbQueries.GetUserByID(r.Context(), pat.UserID)
+		}
+		granted = strings.Fields(pat.Scope)
+	default:
+		err = fmt.Errorf("Expected access token, got %s token", bearer.Kind)
+	}
+	if err != nil {
+		return database.User{}, unauthorized(err)
+	}
+
+	if isSuspended(user) {
+		return database.User{}, func(w http.ResponseWriter) {
+			respondSuspended(w, user)
+		}
+	}
+	if (scope == "" && len(granted) > 0) || !auth.HasScope(granted, scope) {
+		return database.User{}, func(w http.ResponseWriter) {
+			respondInsufficientScope(w, scope)
+		}
+	}
+	return user, nil
+}
+
+// checkSession refuses access tokens of a session that was logged out, so
+// revoking a session cuts off its access tokens right away instead of when
+// they expire.
+func (a *apiConfig) checkSession(ctx context.Context, sessionID uuid.UUID) error {
+	active, err := a.dbQueries.SessionIsActive(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return fmt.Errorf("This session has been logged out")
+	}
+	return nil
+}
+
+// checkClient refuses access tokens issued to an OAuth client that has since
+// been deleted.
+func (a *apiConfig) checkClient(ctx context.Context, clientID string) error {
+	_, err := a.dbQueries.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("The app this token was issued to has been removed")
+	}
+	return err
+}
+
+// respondInsufficientScope refuses a token that can't be used for the
+// request, as RFC 6750 describes.
+func respondInsufficientScope(w http.ResponseWriter, scope string) {
+	if scope == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		respondWithError(w, http.StatusForbidden, "This needs a token from a login, not a restricted one")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+	respondWithError(w, http.StatusForbidden, "This token doesn't have the " + scope + " scope")
+}
+
+// makeAccessToken issues an access token for user. sessionID is the refresh
+// token family the token belongs to.
+func (a *apiConfig) makeAccessToken(user database.User, sessionID uuid.UUID) (string, error) {
+	return auth.MakeJWT(auth.AccessToken{
+		UserID: user.ID,
+		Version: user.TokenVersion,
+		SessionID: sessionID,
+	}, a.jwtKeys, a.tokenConfig)
+}
+
+func isSuspended(user database.User) bool {
+	return user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(time.Now().UTC())
+}
+
+func respondSuspended(w http.ResponseWriter, user database.User) {
+	respondWithError(w, http.StatusForbidden,
+		"This account is suspended until " + user.SuspendedUntil.Time.Format(time.RFC3339))
+}
+
+// handleReset deletes every user. Even admins can only do it on a
+// development server.
+func (a *apiConfig) handleReset(w http.ResponseWriter, r *http.Request, user database.User) {
 	if a.platform != "dev" {
 		w.WriteHeader(http.StatusForbidden)
 		return
@@ -54,6 +266,7 @@ func (a *apiConfig) handleReset(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	} else {
+		a.audit(r, auditEvent{Event: auditAdminReset, ActorID: user.ID})
 		log.Printf("Succesfully deleted all users")
 	}
 }
@@ -66,7 +279,15 @@ func (a *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	}
 	input := userInput{}
 	decodeInput(w, r, &input)
-	passwd, err := auth.HashPassword(input.Password)
+	email, err := validate.Email(input.Email)
+	if err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	if !a.checkPassword(w, input.Password, email) {
+		return
+	}
+	passwd, err := auth.HashPassword(input.Password, a.passwordParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -77,11 +298,12 @@ func (a *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
 	}
 
 	user, err := a.dbQueries.CreateUser(r.Context(), database.CreateUserParams{
-		Email: input.Email,
+		Email: email,
 		HashedPassword: passwd,
 	})
 	if err != nil {
@@ -89,11 +311,17 @@ func (a *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account exists either way; a lost email can be sent again.
+	if err := a.startEmailVerification(r, user, user.Email); err != nil {
+		log.Printf("Couldn't start email verification for user %v: %v", user.ID, err)
+	}
+
 	userData := userResponse{
 		Id: user.ID,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
@@ -109,24 +337,109 @@ func (a *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 	input := userInput{}
 	decodeInput(w, r, &input)
 
+	attempt, ok := a.reserveLoginAttempt(w, r, a.loginSubjects(r, input.Email))
+	if !ok {
+		return
+	}
+
 	user, err := a.dbQueries.GetUserByEmail(r.Context(), input.Email)
-	if err != nil {
+	found := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	hash := user.HashedPassword
+	if !found {
+		hash = a.dummyPasswordHash
+	}
 
-	check, err := auth.CheckPasswordHash(input.Password, user.HashedPassword)
+	check, err := auth.CheckPasswordHash(input.Password, hash)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if !check {
+	if !check || !found {
+		failLoginAttempt(attempt)
+		a.audit(r, auditEvent{
+			Event: auditLoginFailed,
+			UserID: user.ID,
+			Metadata: map[string]any{"method": "password", "email": input.Email},
+		})
 		log.Printf("Failed log in attempt")
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	}
+	a.rehashPassword(r.Context(), user, input.Password)
+	if !user.TotpEnabledAt.Valid && !isSuspended(user) {
+		// Failures are only forgotten once the login goes through: with
+		// two-factor authentication, after the second factor.
+		if err := a.clearLoginFailures(r.Context(), attempt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else if err := a.releaseLoginAttempt(r.Context(), attempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isSuspended(user) {
+		log.Printf("Suspended user tried to log in")
+		respondSuspended(w, user)
+		return
+	}
 
-	token, err := auth.MakeJWT(user.ID, a.jwtSecret)
+	if user.TotpEnabledAt.Valid {
+		log.Printf("Password accepted, waiting for the second factor")
+		a.respondMFARequired(w, user)
+		return
+	}
+	a.issueSession(w, r, user, "password")
+}
+
+// respondMFARequired answers a first login step for a user with two-factor
+// authentication with the MFA token loginMFA takes.
+func (a *apiConfig) respondMFARequired(w http.ResponseWriter, user database.User) {
+	mfaToken, err := auth.MakeMFAToken(user.ID, user.TokenVersion, a.jwtKeys, a.tokenConfig)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	type mfaResponse struct {
+		MFARequired bool `json:"mfa_required"`
+		MFAToken string `json:"mfa_token"`
+	}
+	respondWithJSON(w, http.StatusOK, mfaResponse{MFARequired: true, MFAToken: mfaToken})
+}
+
+// rehashPassword upgrades the user's password hash when it was made with
+// other parameters than the current ones. The login goes on whether or not
+// it works, the next one will try again.
+func (a *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	rehash, err := auth.NeedsRehash(user.HashedPassword, a.passwordParams)
+	if err != nil || !rehash {
+		return
+	}
+	newHash, err := auth.HashPassword(password, a.passwordParams)
+	if err == nil {
+		_, err = a.dbQueries.RehashPassword(ctx, database.RehashPasswordParams{
+			NewHash: newHash,
+			ID: user.ID,
+			OldHash: user.HashedPassword,
+		})
+	}
+	if err != nil {
+		log.Printf("Couldn't rehash the password of user %v: %v", user.ID, err)
+		return
+	}
+	log.Printf("Rehashed the password of user %v with the current parameters", user.ID)
+}
+
+// issueSession finishes a login: it starts a new session (refresh token
+// family) for user and responds with the user, an access token and the
+// session's first refresh token. method names how the user logged in, for
+// the audit log.
+func (a *apiConfig) issueSession(w http.ResponseWriter, r *http.Request, user database.User, method string) {
+	familyID := uuid.New()
+	token, err := a.makeAccessToken(user, familyID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -138,21 +451,31 @@ func (a *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_, err = a.dbQueries.RegisterRefreshToken(r.Context(), database.RegisterRefreshTokenParams{
-		Token: refreshToken,
+		ID: refreshToken.Selector,
+		TokenHash: refreshToken.VerifierHash,
 		UserID: user.ID,
-		ExpiresAt: time.Now().Add(60 * 24*time.Hour),
+		ExpiresAt: time.Now().UTC().Add(a.tokenConfig.RefreshTTL),
+		FamilyID: familyID,
+		UserAgent: r.UserAgent(),
+		Ip: a.clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-
+	a.audit(r, auditEvent{
+		Event: auditLoginSucceeded,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"method": method, "session_id": familyID},
+	})
 
 	type userResponse struct {
 		Id uuid.UUID `json:"id"`
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
 		Token string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
@@ -163,8 +486,9 @@ func (a *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 		Token: token,
-		RefreshToken: refreshToken,
+		RefreshToken: refreshToken.Token,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
@@ -172,41 +496,72 @@ func (a *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, userData)
 }
 
-func (a *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header, "jwt")
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-	userID, err := auth.ValidateJWT(token, a.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
+// updateUser changes the password right away. A new email only replaces the
+// current one once it is verified: a verification token is sent to it and
+// the response lists it as pending.
+func (a *apiConfig) updateUser(w http.ResponseWriter, r *http.Request, user database.User) {
 	type updateInput struct {
 		Email string `json:"email"`
 		Password string `json:"password"`
 	}
 	input := updateInput{}
 	decodeInput(w, r, &input)
-	passwd, err := auth.HashPassword(input.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
 
-	user, err := a.dbQueries.UpdateEmailAndPassword(r.Context(), database.UpdateEmailAndPasswordParams{
-		Email: input.Email,
-		HashedPassword: passwd,
-		ID: userID,
-	})
+	pendingEmail := ""
+	if input.Email != "" {
+		email, err := validate.Email(input.Email)
+		if err != nil {
+			respondWithValidationError(w, err)
+			return
+		}
+		if email != user.Email {
+			pendingEmail = email
+		}
+	}
+
+	if input.Password != "" {
+		if !a.checkPassword(w, input.Password, user.Email) {
+			return
+		}
+		if pendingEmail != "" && !a.checkPassword(w, input.Password, pendingEmail) {
+			return
+		}
+		passwd, err := auth.HashPassword(input.Password, a.passwordParams)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		user, err = a.dbQueries.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+			ID: user.ID,
+			HashedPassword: passwd,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		a.audit(r, auditEvent{Event: auditPasswordChanged, ActorID: user.ID, UserID: user.ID})
+	}
+
+	if pendingEmail != "" {
+		if err := a.startEmailVerification(r, user, pendingEmail); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		a.audit(r, auditEvent{
+			Event: auditEmailChangeRequested,
+			ActorID: user.ID,
+			UserID: user.ID,
+			Metadata: map[string]any{"new_email": pendingEmail},
+		})
+	}
 
 	type userResponse struct {
 		Id uuid.UUID `json:"id"`
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
+		PendingEmail string `json:"pending_email,omitempty"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
 	}
 	userData := userResponse{
@@ -214,6 +569,8 @@ func (a *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail: pendingEmail,
 		IsChirpyRed: user.IsChirpyRed,
 	}
 
@@ -221,25 +578,130 @@ func (a *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, userData)
 }
 
-func (a *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header, "refresh")
+var (
+	errUnknownRefreshToken = errors.New("Unknown refresh token")
+	errRefreshTokenReused = errors.New("This refresh token has already been used, please log in again")
+	errRefreshTokenRevoked = errors.New("This refresh token has been revoked")
+	errRefreshTokenExpired = errors.New("This refresh token has expired")
+	errAccountSuspended = errors.New("This account is suspended")
+)
+
+// rotateRefreshToken trades a refresh token for a new one in the same family,
+// revoking the one presented. Every token issued from the same login shares a
+// family; presenting a token that was already rotated means it was copied, so
+// the whole family is revoked and the user must log in again. Tokens issued to
+// an OAuth client only rotate for that client. It returns the token presented
+// and the user it belongs to.
+func (a *apiConfig) rotateRefreshToken(r *http.Request, token string, clientID sql.NullString) (database.RefreshToken, database.User, auth.SplitToken, error) {
+	selector, verifier, err := auth.ParseRefreshToken(token)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return database.RefreshToken{}, database.User{}, auth.SplitToken{}, errUnknownRefreshToken
+	}
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.RefreshToken{}, database.User{}, auth.SplitToken{}, err
+	}
+
+	var refreshToken database.RefreshToken
+	var user database.User
+	var result error
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		refreshToken, err = q.GetRefreshTokenForUpdate(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if !auth.CheckVerifier(verifier, refreshToken.TokenHash) || refreshToken.ClientID != clientID {
+			return sql.ErrNoRows
+		}
+
+		if refreshToken.RevokedAt.Valid {
+			if refreshToken.ReplacedBy.Valid {
+				result = errRefreshTokenReused
+				_, err = q.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID)
+				return err
+			}
+			result = errRefreshTokenRevoked
+			return nil
+		}
+		if !refreshToken.ExpiresAt.After(time.Now().UTC()) {
+			result = errRefreshTokenExpired
+			return nil
+		}
+
+		user, err = q.GetUserByID(r.Context(), refreshToken.UserID)
+		if err != nil {
+			return err
+		}
+		if isSuspended(user) {
+			result = errAccountSuspended
+			return nil
+		}
+
+		_, err = q.RegisterRefreshToken(r.Context(), database.RegisterRefreshTokenParams{
+			ID: newRefreshToken.Selector,
+			TokenHash: newRefreshToken.VerifierHash,
+			UserID: refreshToken.UserID,
+			ExpiresAt: time.Now().UTC().Add(a.tokenConfig.RefreshTTL),
+			FamilyID: refreshToken.FamilyID,
+			UserAgent: r.UserAgent(),
+			Ip: a.clientIP(r),
+			ClientID: refreshToken.ClientID,
+			Scope: refreshToken.Scope,
+		})
+		if err != nil {
+			return err
+		}
+		return q.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+			ID: selector,
+			ReplacedBy: sql.NullString{String: newRefreshToken.Selector, Valid: true},
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.RefreshToken{}, database.User{}, auth.SplitToken{}, errUnknownRefreshToken
+	}
+	if err != nil {
+		return database.RefreshToken{}, database.User{}, auth.SplitToken{}, err
+	}
+	metadata := map[string]any{"session_id": refreshToken.FamilyID}
+	if refreshToken.ClientID.Valid {
+		metadata["client_id"] = refreshToken.ClientID.String
+	}
+	if errors.Is(result, errRefreshTokenReused) {
+		a.audit(r, auditEvent{Event: auditTokenReused, UserID: refreshToken.UserID, Metadata: metadata})
+		log.Printf("Refresh token reuse detected, revoked token family %v", refreshToken.FamilyID)
+	}
+	if result != nil {
+		return refreshToken, user, auth.SplitToken{}, result
 	}
+	a.audit(r, auditEvent{Event: auditTokenRefreshed, ActorID: user.ID, UserID: user.ID, Metadata: metadata})
+	return refreshToken, user, newRefreshToken, nil
+}
 
-	refreshToken, err := a.dbQueries.GetRefreshToken(r.Context(), token)
+// handleRefresh trades a refresh token from a login for a new access token
+// and a new refresh token.
+func (a *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header, auth.TokenRefresh)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	if refreshToken.RevokedAt.Valid {
-		respondWithError(w, http.StatusUnauthorized, "This refresh token has been revoked")
+	refreshToken, user, newRefreshToken, err := a.rotateRefreshToken(r, token, sql.NullString{})
+	if errors.Is(err, errAccountSuspended) {
+		respondSuspended(w, user)
+		return
+	}
+	if errors.Is(err, errUnknownRefreshToken) || errors.Is(err, errRefreshTokenReused) ||
+		errors.Is(err, errRefreshTokenRevoked) || errors.Is(err, errRefreshTokenExpired) {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	newToken, err := auth.MakeJWT(refreshToken.UserID, a.jwtSecret)
+	newToken, err := a.makeAccessToken(user, refreshToken.FamilyID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -247,9 +709,11 @@ func (a *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
 
 	type refreshOut struct {
 		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	refreshData := refreshOut{
 		Token: newToken,
+		RefreshToken: newRefreshToken.Token,
 	}
 
 	log.Printf("Refreshed token Succesfully")
@@ -257,17 +721,35 @@ func (a *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *apiConfig) handleRevoke(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header, "refresh")
+	token, err := auth.GetBearerToken(r.Header, auth.TokenRefresh)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	err = a.dbQueries.RevokeRefreshToken(r.Context(), token)
+	selector, verifier, err := auth.ParseRefreshToken(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	refreshToken, err := a.dbQueries.GetRefreshToken(r.Context(), selector)
+	if err != nil || !auth.CheckVerifier(verifier, refreshToken.TokenHash) || refreshToken.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Unknown refresh token")
+		return
+	}
+
+	err = a.dbQueries.RevokeRefreshToken(r.Context(), refreshToken.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	a.audit(r, auditEvent{
+		Event: auditTokenRevoked,
+		ActorID: refreshToken.UserID,
+		UserID: refreshToken.UserID,
+		Metadata: map[string]any{"session_id": refreshToken.FamilyID},
+	})
 
 	log.Printf("A refresh token has been revoked.")
 	w.WriteHeader(204)
@@ -305,12 +787,25 @@ func (a *apiConfig) polkaWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := a.dbQueries.UpgradeUser(r.Context(), userID)
+	user, err := a.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	// Not a 2xx, so Polka retries and the upgrade goes through once the
+	// email is verified.
+	if a.verifiedEmailRequired && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "User hasn't verified their email")
+		return
+	}
+
+	user, err = a.dbQueries.UpgradeUser(r.Context(), userID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
+	a.audit(r, auditEvent{Event: auditChirpyRedUpgraded, UserID: user.ID, Metadata: map[string]any{"source": "polka"}})
 	log.Printf("User %v upgraded to Chirpy Red", user.Email)
 	w.WriteHeader(204)
 }
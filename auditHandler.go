@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Security events kept in the audit log. Admin and moderation actions from
+// the moderation log are also recorded, as "admin.<action>" and
+// "moderation.<action>".
+const (
+	auditLoginSucceeded = "login.succeeded"
+	auditLoginFailed = "login.failed"
+	auditTokenRefreshed = "token.refreshed"
+	auditTokenReused = "token.reuse_detected"
+	auditTokenRevoked = "token.revoked"
+	auditSessionRevoked = "session.revoked"
+	auditSessionsRevoked = "sessions.revoked"
+	auditPasswordChanged = "password.changed"
+	auditPasswordReset = "password.reset"
+	auditEmailChangeRequested = "email.change_requested"
+	auditEmailChanged = "email.changed"
+	auditIdentityLinked = "identity.linked"
+	auditIdentityTakeover = "identity.takeover"
+	auditTOTPEnabled = "totp.enabled"
+	auditTOTPDisabled = "totp.disabled"
+	auditRecoveryCodesRegenerated = "recovery_codes.regenerated"
+	auditPasskeyAdded = "passkey.added"
+	auditPasskeyRemoved = "passkey.removed"
+	auditPersonalTokenCreated = "personal_access_token.created"
+	auditPersonalTokenDeleted = "personal_access_token.deleted"
+	auditOAuthConsented = "oauth.consented"
+	auditOAuthGranted = "oauth.granted"
+	auditChirpyRedUpgraded = "chirpy_red.upgraded"
+	auditChirpDeleted = "chirp.deleted"
+	auditBannedTermAdded = "banned_term.added"
+	auditBannedTermUpdated = "banned_term.updated"
+	auditBannedTermDeleted = "banned_term.deleted"
+	auditAdminSetRole = "admin.set_role"
+	auditAdminClearLockout = "admin.clear_lockout"
+	auditAdminReset = "admin.reset"
+)
+
+// auditEvent is one entry of the audit log. UserID is the account the event
+// is about and ActorID whoever caused it; either can be uuid.Nil when nobody
+// is known, e.g. a failed login for an email without an account.
+type auditEvent struct {
+	Event string
+	ActorID uuid.UUID
+	UserID uuid.UUID
+	Metadata map[string]any
+}
+
+// appendAudit writes event with q, so it can be part of the transaction
+// making the change it records.
+func (a *apiConfig) appendAudit(q *database.Queries, r *http.Request, event auditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+	return q.AppendAuditEvent(r.Context(), database.AppendAuditEventParams{
+		Event: event.Event,
+		ActorID: uuid.NullUUID{UUID: event.ActorID, Valid: event.ActorID != uuid.Nil},
+		UserID: uuid.NullUUID{UUID: event.UserID, Valid: event.UserID != uuid.Nil},
+		Ip: a.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Metadata: metadata,
+	})
+}
+
+// audit records event after the fact. The request it belongs to already
+// went through, so a failure is only logged.
+func (a *apiConfig) audit(r *http.Request, event auditEvent) {
+	if err := a.appendAudit(a.dbQueries, r, event); err != nil {
+		log.Printf("Couldn't record audit event %s: %v", event.Event, err)
+	}
+}
+
+type auditEventResponse struct {
+	Id uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Event string `json:"event"`
+	ActorId *uuid.UUID `json:"actor_id"`
+	UserId *uuid.UUID `json:"user_id"`
+	Ip string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+func toAuditEventResponses(events []database.AuditEvent) []auditEventResponse {
+	optional := func(id uuid.NullUUID) *uuid.UUID {
+		if !id.Valid {
+			return nil
+		}
+		return &id.UUID
+	}
+	eventsData := []auditEventResponse{}
+	for _, event := range events {
+		eventsData = append(eventsData, auditEventResponse{
+			Id: event.ID,
+			CreatedAt: event.CreatedAt,
+			Event: event.Event,
+			ActorId: optional(event.ActorID),
+			UserId: optional(event.UserID),
+			Ip: event.Ip,
+			UserAgent: event.UserAgent,
+			Metadata: event.Metadata,
+		})
+	}
+	return eventsData
+}
+
+// auditFilter reads the filters of GET /admin/audit from query. It returns
+// the message for a 400 when one doesn't parse.
+func auditFilter(query url.Values) (database.ListAuditEventsParams, string) {
+	params := database.ListAuditEventsParams{MaxResults: 100}
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			return params, "Limit must be between 1 and 1000"
+		}
+		params.MaxResults = int32(n)
+	}
+	if v := query.Get("event"); v != "" {
+		params.Event.String, params.Event.Valid = v, true
+	}
+	if v := query.Get("ip"); v != "" {
+		params.Ip.String, params.Ip.Valid = v, true
+	}
+	if v := query.Get("actor_id"); v != "" {
+		actorID, err := uuid.Parse(v)
+		if err != nil {
+			return params, "actor_id must be a UUID"
+		}
+		params.ActorID = uuid.NullUUID{UUID: actorID, Valid: true}
+	}
+	if v := query.Get("user_id"); v != "" {
+		userID, err := uuid.Parse(v)
+		if err != nil {
+			return params, "user_id must be a UUID"
+		}
+		params.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, "since must be an RFC 3339 time"
+		}
+		params.Since.Time, params.Since.Valid = since.UTC(), true
+	}
+	if v := query.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, "until must be an RFC 3339 time"
+		}
+		params.Until.Time, params.Until.Valid = until.UTC(), true
+	}
+	return params, ""
+}
+
+// getAuditLog lists audit events, newest first. Older pages are fetched by
+// passing the created_at of the last event as "until".
+func (a *apiConfig) getAuditLog(w http.ResponseWriter, r *http.Request, admin database.User) {
+	params, msg := auditFilter(r.URL.Query())
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	events, err := a.dbQueries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, toAuditEventResponses(events))
+}
+
+// getSecurityEvents lists the events about the signed in user's own account,
+// so they can spot logins and changes they didn't make. Moderation is left
+// out, they hear about it through warnings, and so is who the other actors
+// were. It takes the filters of GET /admin/audit except actor_id and user_id.
+func (a *apiConfig) getSecurityEvents(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+	if query.Has("actor_id") || query.Has("user_id") {
+		respondWithError(w, http.StatusBadRequest, "Only your own events can be listed, actor_id and user_id aren't supported")
+		return
+	}
+	params, msg := auditFilter(query)
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	events, err := a.dbQueries.ListUserAuditEvents(r.Context(), database.ListUserAuditEventsParams{
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Event: params.Event,
+		Ip: params.Ip,
+		Since: params.Since,
+		Until: params.Until,
+		MaxResults: params.MaxResults,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	eventsData := toAuditEventResponses(events)
+	for i := range eventsData {
+		if eventsData[i].ActorId != nil && *eventsData[i].ActorId != user.ID {
+			eventsData[i].ActorId = nil
+		}
+	}
+	respondWithJSON(w, http.StatusOK, eventsData)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAuditFilter(t *testing.T) {
+	params, msg := auditFilter(url.Values{})
+	if msg != "" {
+		t.Errorf("unexpected error for no filters: %s", msg)
+		return
+	}
+	if params.MaxResults != 100 || params.Event.Valid || params.UserID.Valid || params.Since.Valid {
+		t.Errorf("expected only the default limit, got %+v", params)
+		return
+	}
+
+	params, msg = auditFilter(url.Values{
+		"event": {auditLoginFailed},
+		"user_id": {"5f0c7a4e-8a0f-4b8e-9c43-2d3a0f6b1e7d"},
+		"since": {"2024-05-01T12:00:00+02:00"},
+		"limit": {"20"},
+	})
+	if msg != "" {
+		t.Errorf("unexpected error: %s", msg)
+		return
+	}
+	if params.Event.String != auditLoginFailed || !params.UserID.Valid || params.MaxResults != 20 {
+		t.Errorf("filters weren't applied: %+v", params)
+		return
+	}
+	if params.Since.Time.Hour() != 10 || params.Since.Time.Location() != time.UTC {
+		t.Errorf("expected since in UTC, got %v", params.Since.Time)
+		return
+	}
+
+	for _, bad := range []url.Values{
+		{"limit": {"0"}},
+		{"actor_id": {"not-a-uuid"}},
+		{"until": {"yesterday"}},
+	} {
+		if _, msg := auditFilter(bad); msg == "" {
+			t.Errorf("expected %v to be refused", bad)
+		}
+	}
+}
+
+// requestFrom is s.request from ip.
+func (s *testServer) requestFrom(ip, method, path, token string, body any) *httptest.ResponseRecorder {
+	r := newTestRequest(method, path, token, body)
+	r.RemoteAddr = ip + ":4321"
+	return s.serve(r)
+}
+
+// checkAuditEvent checks that ip caused exactly one event, recorded with
+// actorID and userID.
+func (s *testServer) checkAuditEvent(event, ip string, actorID, userID uuid.UUID) error {
+	events, err := s.api.dbQueries.ListAuditEvents(context.Background(), database.ListAuditEventsParams{
+		Event: sql.NullString{String: event, Valid: true},
+		Ip: sql.NullString{String: ip, Valid: true},
+		MaxResults: 10,
+	})
+	if err != nil {
+		return err
+	}
+	if len(events) != 1 {
+		return fmt.Errorf("expected one %s event from %s, got %d", event, ip, len(events))
+	}
+	if events[0].ActorID.UUID != actorID || events[0].UserID.UUID != userID {
+		return fmt.Errorf("expected %s by %v about %v, got %+v", event, actorID, userID, events[0])
+	}
+	return nil
+}
+
+func TestAuditEventsAreRecorded(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	gus, err := s.signUp("gus@lospolloshermanos.com", "i hide in plain sight", "admin")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	w := s.requestFrom("203.0.113.1", "POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": "say my name heisenberg"})
+	if w.Code != http.StatusOK {
+		t.Errorf("couldn't log in: %d %s", w.Code, w.Body.String())
+		return
+	}
+	if err := s.checkAuditEvent(auditLoginSucceeded, "203.0.113.1", walt.Id, walt.Id); err != nil {
+		t.Errorf("login: %v", err)
+		return
+	}
+
+	s.request("POST", "/api/password-reset/request", "", map[string]string{"email": "walt@breakingbad.com"})
+	token := s.mailedToken("walt@breakingbad.com", auth.PasswordResetTokenPrefix)
+	w = s.requestFrom("203.0.113.2", "POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "new_password": "i am the one who knocks"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("couldn't reset the password: %d %s", w.Code, w.Body.String())
+		return
+	}
+	if err := s.checkAuditEvent(auditPasswordReset, "203.0.113.2", walt.Id, walt.Id); err != nil {
+		t.Errorf("password reset: %v", err)
+		return
+	}
+
+	w = s.requestFrom("203.0.113.3", "POST", "/admin/users/" + walt.Id.String() + "/revoke-sessions", gus.Token, nil)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("couldn't revoke the sessions: %d %s", w.Code, w.Body.String())
+		return
+	}
+	if err := s.checkAuditEvent("admin." + adminRevokeSessions, "203.0.113.3", gus.Id, walt.Id); err != nil {
+		t.Errorf("admin action: %v", err)
+	}
+}
+
+func TestSecurityEventsFilters(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	if _, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user"); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	w := s.requestFrom("203.0.113.1", "POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": "say my name heisenberg"})
+	if w.Code != http.StatusOK {
+		t.Errorf("couldn't log in: %d %s", w.Code, w.Body.String())
+		return
+	}
+	walt := testLogin{}
+	if err := json.Unmarshal(w.Body.Bytes(), &walt); err != nil {
+		t.Errorf("couldn't decode the login: %v", err)
+		return
+	}
+	w = s.request("POST", "/api/tokens", walt.Token, map[string]any{"name": "cook bot", "scopes": []string{auth.ScopeProfileRead}})
+	if w.Code != http.StatusCreated {
+		t.Errorf("couldn't create a token: %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	cases := []struct {
+		query string
+		want []string
+	}{
+		{query: "", want: []string{auditPersonalTokenCreated, auditLoginSucceeded, auditLoginSucceeded}},
+		{query: "?event=" + auditLoginSucceeded, want: []string{auditLoginSucceeded, auditLoginSucceeded}},
+		{query: "?ip=203.0.113.1", want: []string{auditLoginSucceeded}},
+		{query: "?limit=1", want: []string{auditPersonalTokenCreated}},
+		{query: "?since=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)), want: []string{}},
+		{query: "?until=" + url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)), want: []string{}},
+	}
+	for _, c := range cases {
+		w := s.request("GET", "/api/users/me/security-events" + c.query, walt.Token, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: expected 200, got %d %s", c.query, w.Code, w.Body.String())
+			continue
+		}
+		events := []auditEventResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+			t.Errorf("%q: couldn't decode the events: %v", c.query, err)
+			continue
+		}
+		got := []string{}
+		for _, event := range events {
+			got = append(got, event.Event)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%q: expected %v, got %v", c.query, c.want, got)
+		}
+	}
+
+	for _, query := range []string{"?actor_id=" + walt.Id.String(), "?user_id=" + walt.Id.String(), "?limit=0"} {
+		if w := s.request("GET", "/api/users/me/security-events" + query, walt.Token, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/moderation"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+type bannedTermResponse struct {
+	Id uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Term string `json:"term"`
+	MatchType string `json:"match_type"`
+}
+
+func convertBannedTerm(term database.BannedTerm) bannedTermResponse {
+	return bannedTermResponse{
+		Id: term.ID,
+		CreatedAt: term.CreatedAt,
+		UpdatedAt: term.UpdatedAt,
+		Term: term.Term,
+		MatchType: term.MatchType,
+	}
+}
+
+type bannedTermInput struct {
+	Term string `json:"term"`
+	MatchType string `json:"match_type"`
+}
+
+// rule validates the input and defaults the match type to whole words.
+func (in *bannedTermInput) rule() (moderation.Rule, error) {
+	if in.MatchType == "" {
+		in.MatchType = string(moderation.MatchWord)
+	}
+	rule := moderation.Rule{
+		Term: in.Term,
+		Match: moderation.MatchType(in.MatchType),
+	}
+
+	var errs validate.Errors
+	if err := rule.Validate(); err != nil {
+		field := "term"
+		switch rule.Match {
+		case moderation.MatchWord, moderation.MatchSubstring, moderation.MatchRegex:
+		default:
+			field = "match_type"
+		}
+		errs.Add(field, "invalid", err.Error())
+	}
+	return rule, errs.Err()
+}
+
+func (a *apiConfig) listBannedTerms(w http.ResponseWriter, r *http.Request, user database.User) {
+	terms, err := a.dbQueries.ListBannedTerms(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	termsData := []bannedTermResponse{}
+	for _, term := range terms {
+		termsData = append(termsData, convertBannedTerm(term))
+	}
+	respondWithJSON(w, http.StatusOK, termsData)
+}
+
+func (a *apiConfig) getBannedTerm(w http.ResponseWriter, r *http.Request, user database.User) {
+	termID, err := uuid.Parse(r.PathValue("termID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	term, err := a.dbQueries.GetBannedTerm(r.Context(), termID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find banned term on database")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, convertBannedTerm(term))
+}
+
+func (a *apiConfig) createBannedTerm(w http.ResponseWriter, r *http.Request, user database.User) {
+	input := bannedTermInput{}
+	decodeInput(w, r, &input)
+	rule, err := input.rule()
+	if err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	term, err := a.dbQueries.CreateBannedTerm(r.Context(), database.CreateBannedTermParams{
+		Term: rule.Term,
+		MatchType: string(rule.Match),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	a.bannedTerms.Invalidate()
+
+	a.audit(r, auditEvent{
+		Event: auditBannedTermAdded,
+		ActorID: user.ID,
+		Metadata: map[string]any{"term_id": term.ID, "term": term.Term, "match_type": term.MatchType},
+	})
+	log.Printf("Banned term added: %q (%s)", term.Term, term.MatchType)
+	respondWithJSON(w, http.StatusCreated, convertBannedTerm(term))
+}
+
+func (a *apiConfig) updateBannedTerm(w http.ResponseWriter, r *http.Request, user database.User) {
+	termID, err := uuid.Parse(r.PathValue("termID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input := bannedTermInput{}
+	decodeInput(w, r, &input)
+	rule, err := input.rule()
+	if err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	term, err := a.dbQueries.UpdateBannedTerm(r.Context(), database.UpdateBannedTermParams{
+		ID: termID,
+		Term: rule.Term,
+		MatchType: string(rule.Match),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find banned term on database")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	a.bannedTerms.Invalidate()
+
+	a.audit(r, auditEvent{
+		Event: auditBannedTermUpdated,
+		ActorID: user.ID,
+		Metadata: map[string]any{"term_id": term.ID, "term": term.Term, "match_type": term.MatchType},
+	})
+	log.Printf("Banned term %v updated", term.ID)
+	respondWithJSON(w, http.StatusOK, convertBannedTerm(term))
+}
+
+func (a *apiConfig) deleteBannedTerm(w http.ResponseWriter, r *http.Request, user database.User) {
+	termID, err := uuid.Parse(r.PathValue("termID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := a.dbQueries.DeleteBannedTerm(r.Context(), termID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find banned term on database")
+		return
+	}
+	a.bannedTerms.Invalidate()
+
+	a.audit(r, auditEvent{
+		Event: auditBannedTermDeleted,
+		ActorID: user.ID,
+		Metadata: map[string]any{"term_id": termID},
+	})
+	log.Printf("Banned term %v deleted", termID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+// browserCookie holds a random value that logins started outside Chirpy
+// (at an identity provider, from an email) are tied to, so finishing one
+// only works in the browser that started it.
+const browserCookie = "chirpy_browser"
+
+// bindBrowser returns the hash of the browser's binding cookie to store
+// with a login, setting the cookie first when the browser has none.
+func (a *apiConfig) bindBrowser(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(browserCookie); err == nil && len(cookie.Value) == 64 {
+		return auth.HashVerifier(cookie.Value), nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name: browserCookie,
+		Value: value,
+		Path: "/api/login",
+		HttpOnly: true,
+		Secure: a.platform != "dev",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return auth.HashVerifier(value), nil
+}
+
+// browserMatches reports whether the request comes from the browser whose
+// binding cookie hashes to hash.
+func browserMatches(r *http.Request, hash string) bool {
+	cookie, err := r.Cookie(browserCookie)
+	if err != nil {
+		return false
+	}
+	return auth.CheckVerifier(cookie.Value, hash)
+}
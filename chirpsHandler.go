@@ -17,37 +17,37 @@ type chirpResponse struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body string `json:"body"`
 	UserId uuid.UUID `json:"user_id"`
+	Collapsed bool `json:"collapsed,omitempty"`
+	MutedWords []string `json:"muted_words,omitempty"`
 }
 
 
-func (a *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
+func (a *apiConfig) createChirp(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !a.requireVerifiedEmail(w, user) {
+		return
+	}
+
 	type chirpInput struct {
 		Body string `json:"body"`
 	}
 	input := chirpInput{}
 	decodeInput(w, r, &input)
 
-	if len(input.Body) > 140 {
-		respondWithError(w, 400, "Chirp is too long") //
-		return
-	}
-	cleanBody := cleanWords(input.Body)
-
-	token, err := auth.GetBearerToken(r.Header, "jwt")
+	body, err := a.chirpPolicy.Chirp(input.Body, user.IsChirpyRed)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithValidationError(w, err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, a.jwtSecret)
+	cleanBody, err := a.cleanWords(r.Context(), body)
 	if err != nil {
-		respondWithError(w, http.StatusForbidden, err.Error())
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	chirp, err := a.dbQueries.CreateChirp(r.Context(),
 		database.CreateChirpParams{
 			Body: cleanBody,
-			UserID: userID,
+			UserID: user.ID,
 		})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -64,6 +64,8 @@ func (a *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 	var allChirps []database.Chirp
 	var err error
 
+	viewer := a.optionalViewer(r)
+
 	author := r.URL.Query().Get("author_id")
 	if author != "" {
 		authorID, err := uuid.Parse(author)
@@ -71,13 +73,16 @@ func (a *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		allChirps, err = a.dbQueries.ListChirpsByAuthor(r.Context(), authorID)
+		allChirps, err = a.dbQueries.ListChirpsByAuthor(r.Context(), database.ListChirpsByAuthorParams{
+			UserID: authorID,
+			ViewerID: viewer,
+		})
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 	} else {
-		allChirps, err = a.dbQueries.ListChirps(r.Context())
+		allChirps, err = a.dbQueries.ListChirps(r.Context(), viewer)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -99,6 +104,14 @@ func (a *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 		allChirpsData = append(allChirpsData, *chirpData)
 	}
 
+	if viewer.Valid {
+		allChirpsData, err = a.applyMutes(r.Context(), viewer.UUID, muteScopeHome, allChirpsData)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	respondWithJSON(w, 200, allChirpsData)
 }
 
@@ -111,7 +124,12 @@ func (a *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirp, err := a.dbQueries.GetChirpByID(r.Context(), chirp_id)
+	viewer := a.optionalViewer(r)
+
+	chirp, err := a.dbQueries.GetVisibleChirp(r.Context(), database.GetVisibleChirpParams{
+		ID: chirp_id,
+		ViewerID: viewer,
+	})
 	if err != nil {
 		log.Printf("Chirp Not Found! ID: %v.", chirp_id)
 		respondWithError(w, 404, "Couldn't find chirp on database")
@@ -124,6 +142,23 @@ func (a *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, 200, *chirpData)
 }
 
+// optionalViewer authenticates the request when it carries credentials.
+// Signed in viewers get their muted words applied and see their own chirps
+// even when shadow banned, anyone else sees the public listing. Personal
+// access tokens need the chirps:read scope to sign the viewer in. The
+// listing is public, so credentials that don't work, e.g. an expired token,
+// get it too instead of an error.
+func (a *apiConfig) optionalViewer(r *http.Request) uuid.NullUUID {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}
+	}
+	user, refuse := a.authenticate(r, auth.ScopeChirpsRead)
+	if refuse != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: user.ID, Valid: true}
+}
+
 func convertChirp(chirp database.Chirp) *chirpResponse {
 	chirpData := chirpResponse{
 		Id: chirp.ID,
@@ -136,17 +171,8 @@ func convertChirp(chirp database.Chirp) *chirpResponse {
 }
 
 
-func (a *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header, "jwt")
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-	userID, err := auth.ValidateJWT(token, a.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
+func (a *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID := user.ID
 
 	id := r.PathValue("chirpID")
 
@@ -173,6 +199,12 @@ func (a *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	a.audit(r, auditEvent{
+		Event: auditChirpDeleted,
+		ActorID: userID,
+		UserID: userID,
+		Metadata: map[string]any{"chirp_id": chirp_id},
+	})
 	
 	log.Printf("Chirp Deleted Succesfully!")
 	w.WriteHeader(204)
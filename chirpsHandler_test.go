@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestOptionalViewerIgnoresBadCredentials(t *testing.T) {
+	a := &apiConfig{jwtKeys: auth.NewHMACKeySet("secret"), tokenConfig: auth.DefaultTokenConfig()}
+
+	expiredConfig := a.tokenConfig
+	expiredConfig.AccessTTL = -time.Hour
+	expired, err := auth.MakeJWT(auth.AccessToken{UserID: uuid.New()}, a.jwtKeys, expiredConfig)
+	if err != nil {
+		t.Errorf("couldn't make a token: %v", err)
+		return
+	}
+
+	for _, header := range []string{"", "Bearer " + expired, "Bearer not-a-token", "Basic d2FsdDpoZWlzZW5iZXJn"} {
+		r := httptest.NewRequest("GET", "/api/chirps", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if viewer := a.optionalViewer(r); viewer.Valid {
+			t.Errorf("expected the anonymous listing for %q, got viewer %v", header, viewer.UUID)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Command argon2-calibrate times Argon2id on this machine and prints the
+// ARGON2_* settings that make one password hash take about -target.
+//
+// Run it on the hardware the server runs on, while it is otherwise idle:
+//
+//	go run ./cmd/argon2-calibrate -target 250ms -max-memory 256
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+func main() {
+	target := flag.Duration("target", 250 * time.Millisecond, "how long one hash should take")
+	maxMemory := flag.Uint("max-memory", 256, "most memory one hash may use, in MiB")
+	parallelism := flag.Uint("parallelism", uint(min(runtime.NumCPU(), 255)), "threads one hash may use")
+	rounds := flag.Int("rounds", 3, "hashes timed per candidate, the median counts")
+	flag.Parse()
+
+	if *parallelism < 1 || *parallelism > 255 {
+		log.Fatal("-parallelism must be between 1 and 255")
+	}
+	if *maxMemory < 1 || *maxMemory > 1024 * 1024 {
+		log.Fatal("-max-memory must be between 1 MiB and 1 TiB")
+	}
+	if *rounds < 1 {
+		log.Fatal("-rounds must be at least 1")
+	}
+
+	measure := func(p auth.PasswordParams) time.Duration {
+		took, err := auth.MeasurePasswordParams(p, *rounds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d MiB, %d iterations, %d threads: %v", p.Memory / 1024, p.Iterations, p.Parallelism, took)
+		return took
+	}
+	params := auth.CalibratePasswordParams(*target, uint32(*maxMemory) * 1024, uint8(*parallelism), measure)
+	if err := params.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("ARGON2_MEMORY_KIB=%d\n", params.Memory)
+	fmt.Printf("ARGON2_ITERATIONS=%d\n", params.Iterations)
+	fmt.Printf("ARGON2_PARALLELISM=%d\n", params.Parallelism)
+}
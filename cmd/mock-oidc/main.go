@@ -0,0 +1,39 @@
+// Command mock-oidc runs an OpenID Connect provider that signs everyone in
+// as -email, to try the identity provider login locally:
+//
+//	go run ./cmd/mock-oidc -addr localhost:9000
+//
+// and start the server with OIDC_ISSUER=http://localhost:9000,
+// OIDC_CLIENT_ID=chirpy and OIDC_CLIENT_SECRET=chirpy-secret. Adding
+// login_hint=<email> to the authorization URL signs in as that email
+// instead.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/NHMosko/chirpy/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address to listen on")
+	issuer := flag.String("issuer", "", "issuer URL, http://<addr> by default")
+	clientID := flag.String("client-id", "chirpy", "client ID Chirpy uses")
+	clientSecret := flag.String("client-secret", "chirpy-secret", "client secret Chirpy uses")
+	email := flag.String("email", "walt@breakingbad.com", "verified email of the user everyone signs in as")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+	provider, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	provider.User.Email = *email
+
+	log.Printf("Mock OpenID Connect provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
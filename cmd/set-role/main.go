@@ -0,0 +1,59 @@
+// Command set-role gives an existing user a role, straight in the database
+// at DB_URL. It is how the first admin is made; after that, admins assign
+// roles through PUT /admin/users/{userID}/role.
+//
+//	go run ./cmd/set-role -email walt@breakingbad.com -role admin
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user, who must have signed up already")
+	role := flag.String("role", "admin", "role to give them")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+	godotenv.Load()
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	q := database.New(db)
+	ctx := context.Background()
+
+	roles, err := q.ListRoles(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := []string{}
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	if !slices.Contains(names, *role) {
+		log.Fatalf("Unknown role %q, pick one of %v", *role, names)
+	}
+
+	user, err := q.GetUserByEmail(ctx, *email)
+	if err != nil {
+		log.Fatalf("Couldn't find %s: %v", *email, err)
+	}
+	user, err = q.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: *role})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("User %v (%s) is now %s", user.ID, user.Email, user.Role)
+}
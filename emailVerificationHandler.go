@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// startEmailVerification mails a verification token to email, which is the
+// user's address after signing up or the one they want to change to. Only
+// the latest token sent to a user works.
+func (a *apiConfig) startEmailVerification(r *http.Request, user database.User, email string) error {
+	verification, err := auth.MakeEmailVerificationToken()
+	if err != nil {
+		return err
+	}
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DeleteEmailVerificationTokens(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return q.CreateEmailVerificationToken(r.Context(), database.CreateEmailVerificationTokenParams{
+			ID: verification.Selector,
+			TokenHash: verification.VerifierHash,
+			UserID: user.ID,
+			Email: email,
+			ExpiresAt: time.Now().UTC().Add(emailVerificationTTL),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendMail(r, mailer.Message{
+		To: email,
+		Subject: "Verify your email for Chirpy",
+		Body: fmt.Sprintf("Use this token to confirm %s is the address of your Chirpy account, " +
+			"it expires in %v:\n\n%s\n\n" +
+			"If you don't have a Chirpy account, ignore this email.\n",
+			email, emailVerificationTTL, verification.Token),
+	})
+	return nil
+}
+
+// requireVerifiedEmail refuses users without a verified address when
+// REQUIRE_VERIFIED_EMAIL is set. It writes the error response itself.
+func (a *apiConfig) requireVerifiedEmail(w http.ResponseWriter, user database.User) bool {
+	if a.verifiedEmailRequired && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address first")
+		return false
+	}
+	return true
+}
+
+// verifyEmail uses a verification token. The token is the proof, so no login
+// is needed; for an email change, this is when the address is switched.
+func (a *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	type verifyInput struct {
+		Token string `json:"token"`
+	}
+	input := verifyInput{}
+	decodeInput(w, r, &input)
+
+	selector, verifier, err := auth.ParseEmailVerificationToken(input.Token)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var user database.User
+	errEmailTaken := errors.New("email taken")
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		verification, err := q.GetEmailVerificationTokenForUpdate(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if !auth.CheckVerifier(verifier, verification.TokenHash) || time.Now().UTC().After(verification.ExpiresAt) {
+			return sql.ErrNoRows
+		}
+
+		owner, err := q.GetUserByEmail(r.Context(), verification.Email)
+		if err == nil && owner.ID != verification.UserID {
+			return errEmailTaken
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		previous, err := q.GetUserByID(r.Context(), verification.UserID)
+		if err != nil {
+			return err
+		}
+		user, err = q.VerifyEmail(r.Context(), database.VerifyEmailParams{
+			ID: verification.UserID,
+			Email: verification.Email,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteEmailVerificationTokens(r.Context(), verification.UserID); err != nil {
+			return err
+		}
+		if previous.Email == user.Email {
+			return nil
+		}
+		return a.appendAudit(q, r, auditEvent{
+			Event: auditEmailChanged,
+			UserID: user.ID,
+			Metadata: map[string]any{"old_email": previous.Email, "new_email": user.Email},
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "This verification token is invalid or has expired")
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		respondWithError(w, http.StatusConflict, "That email is already in use")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type verifiedResponse struct {
+		Id uuid.UUID `json:"id"`
+		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
+	}
+	log.Printf("User %v verified their email", user.ID)
+	respondWithJSON(w, http.StatusOK, verifiedResponse{
+		Id: user.ID,
+		Email: user.Email,
+		EmailVerified: true,
+	})
+}
+
+// resendEmailVerification sends a new token for the current address, e.g.
+// when the first one expired.
+func (a *apiConfig) resendEmailVerification(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Your email is already verified")
+		return
+	}
+
+	if err := a.startEmailVerification(r, user, user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+
+	"github.com/NHMosko/chirpy/internal/validate"
 )
 
 
@@ -27,6 +30,25 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	w.Write(errDat)
 }
 
+// respondWithValidationError answers 400 with every field error attached when
+// err carries them, and falls back to a plain error otherwise.
+func respondWithValidationError(w http.ResponseWriter, err error) {
+	var fieldErrs validate.Errors
+	if !errors.As(err, &fieldErrs) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	type validationErr struct {
+		Error string `json:"error"`
+		Fields validate.Errors `json:"fields"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, validationErr{
+		Error: fieldErrs[0].Message,
+		Fields: fieldErrs,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, rawData any) {
 	data, err := json.Marshal(rawData)
 	if err != nil {
@@ -2,42 +2,99 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 
-func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
-	if err != nil {
-		return "", err
+// TokenConfig holds the settings access and refresh tokens are issued and
+// validated with.
+type TokenConfig struct {
+	Issuer string
+	Audience string
+	AccessTTL time.Duration
+	RefreshTTL time.Duration
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{
+		Issuer: "chirpy",
+		Audience: "chirpy",
+		AccessTTL: time.Hour,
+		RefreshTTL: 60 * 24 * time.Hour,
+		Leeway: 30 * time.Second,
 	}
-	return hash, nil
 }
 
-func CheckPasswordHash(password, hash string) (bool, error) {
-	check, err := argon2id.ComparePasswordAndHash(password, hash)
-	return check, err
+// Claims are the claims of the access tokens issued by chirpy. Version is
+// the user's token version at issue time, bumping it in the database revokes
+// every access token issued before.
+type Claims struct {
+	jwt.RegisteredClaims
+	Version int32 `json:"ver"`
+	// TokenUse tells access tokens apart from any other JWT signed with the
+	// same keys.
+	TokenUse TokenKind `json:"token_use"`
+	// Scope is space separated, as in OAuth 2.0. Tokens from a password
+	// login carry none and are not restricted.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID is the refresh token family the token was issued from, so
+	// the token can be refused once its session is logged out.
+	SessionID string `json:"sid,omitempty"`
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
-			Issuer: "chirpy",
-			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
-			Subject: userID.String(),
+// AccessToken is what an access token says about its holder. It doesn't
+// carry the user's role or subscription: requests load the user anyway to
+// check the token version, so changes to those apply right away instead of
+// when the token expires.
+type AccessToken struct {
+	UserID uuid.UUID
+	Version int32
+	Scope []string
+	ClientID string
+	// SessionID is uuid.Nil for tokens issued before sessions were tracked
+	// in access tokens.
+	SessionID uuid.UUID
+	// IssuedAt and ExpiresAt are only set on validated tokens.
+	IssuedAt time.Time
+	ExpiresAt time.Time
+}
+
+func MakeJWT(token AccessToken, keys *KeySet, cfg TokenConfig) (string, error) {
+	now := time.Now().UTC()
+	sessionID := ""
+	if token.SessionID != uuid.Nil {
+		sessionID = token.SessionID.String()
+	}
+	tokenString, err := keys.sign(
+		Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer: cfg.Issuer,
+				Audience: jwt.ClaimStrings{cfg.Audience},
+				IssuedAt: jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(cfg.AccessTTL)),
+				Subject: token.UserID.String(),
+			},
+			Version: token.Version,
+			TokenUse: TokenAccess,
+			Scope: strings.Join(token.Scope, " "),
+			ClientID: token.ClientID,
+			SessionID: sessionID,
 		},
 	)
-	tokenString, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
 		return "", err
 	}
@@ -45,65 +102,312 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
+// TokenVersionFunc returns the current token version of a user.
+type TokenVersionFunc func(userID uuid.UUID) (int32, error)
+
+// ValidateJWT checks the token's signature, issuer, audience and validity
+// window and, unless currentVersion is nil, that it was issued with the
+// user's current token version. The verification key is picked by the
+// token's kid header.
+func ValidateJWT(tokenString string, keys *KeySet, cfg TokenConfig, currentVersion TokenVersionFunc) (AccessToken, error) {
+	claims, userID, err := parseJWT(tokenString, keys, cfg, TokenAccess)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	if currentVersion != nil {
+		version, err := currentVersion(userID)
+		if err != nil {
+			return AccessToken{}, err
+		}
+		if claims.Version != version {
+			return AccessToken{}, fmt.Errorf("Token has been revoked")
+		}
+	}
+
+	sessionID := uuid.Nil
+	if claims.SessionID != "" {
+		sessionID, err = uuid.Parse(claims.SessionID)
+		if err != nil {
+			return AccessToken{}, fmt.Errorf("Invalid session id: %w", err)
+		}
+	}
+
+	return AccessToken{
+		UserID: userID,
+		Version: claims.Version,
+		Scope: strings.Fields(claims.Scope),
+		ClientID: claims.ClientID,
+		SessionID: sessionID,
+		IssuedAt: claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+
+func parseJWT(tokenString string, keys *KeySet, cfg TokenConfig, use TokenKind) (Claims, uuid.UUID, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(
 		tokenString,
 		&claims,
-		func(t *jwt.Token) (any, error) {
-			if "HS256" == t.Method.Alg() {
-				return []byte(tokenSecret), nil
-			}
-			return nil, fmt.Errorf("incorrect method")
-		},
-	) 
+		keys.keyFunc,
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, uuid.Nil, err
+	}
+	if claims.TokenUse != use {
+		return Claims{}, uuid.Nil, fmt.Errorf("Not an %s token", use)
 	}
 
-	userIDString, err := token.Claims.GetSubject()
+	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, uuid.Nil, err
 	}
+	return claims, userID, nil
+}
+
+// mfaTokenTTL is how long a user has to enter their second factor after the
+// password was accepted.
+const mfaTokenTTL = 5 * time.Minute
+
+// MakeMFAToken issues the token that proves the password step of a login
+// succeeded. It is only good for completing the second step, never as an
+// access token.
+func MakeMFAToken(userID uuid.UUID, tokenVersion int32, keys *KeySet, cfg TokenConfig) (string, error) {
+	now := time.Now().UTC()
+	return keys.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: cfg.Issuer,
+			Audience: jwt.ClaimStrings{cfg.Audience},
+			IssuedAt: jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaTokenTTL)),
+			Subject: userID.String(),
+		},
+		Version: tokenVersion,
+		TokenUse: TokenMFAPending,
+	})
+}
 
-	userID, err := uuid.Parse(userIDString)
+// ValidateMFAToken returns the user and token version an MFA token was
+// issued for.
+func ValidateMFAToken(tokenString string, keys *KeySet, cfg TokenConfig) (uuid.UUID, int32, error) {
+	claims, userID, err := parseJWT(tokenString, keys, cfg, TokenMFAPending)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, 0, err
 	}
-
-	return userID, nil
+	return userID, claims.Version, nil
 }
 
+// TokenKind is what a bearer token is for. Access tokens are JWTs carrying
+// a token_use claim; the opaque tokens carry a prefix, so a token's kind is
+// known from the token itself.
+type TokenKind string
+
+const (
+	TokenAccess TokenKind = "access"
+	TokenRefresh TokenKind = "refresh"
+	TokenPersonal TokenKind = "personal"
+	// TokenMFAPending is a JWT handed out between the password and the
+	// second factor of a login. It is sent in the body, never as a bearer.
+	TokenMFAPending TokenKind = "mfa_pending"
+)
+
+const (
+	RefreshTokenPrefix = "chirpy_rt_"
+	PersonalTokenPrefix = "chirpy_pat_"
+	// PasswordResetTokenPrefix marks the one-time tokens sent by email to
+	// reset a password. They never go in an Authorization header.
+	PasswordResetTokenPrefix = "chirpy_prt_"
+	// EmailVerificationTokenPrefix marks the one-time tokens sent to prove
+	// an address belongs to the user.
+	EmailVerificationTokenPrefix = "chirpy_evt_"
+	// ClientSecretPrefix and AuthorizationCodePrefix mark the secrets of
+	// OAuth clients and the codes they trade for tokens.
+	ClientSecretPrefix = "chirpy_cs_"
+	AuthorizationCodePrefix = "chirpy_ac_"
+	// MagicLinkTokenPrefix marks the one-time tokens in login links sent by
+	// email.
+	MagicLinkTokenPrefix = "chirpy_ml_"
+)
 
-func GetBearerToken(headers http.Header, tokenType string) (string, error) {
+type BearerToken struct {
+	Kind TokenKind
+	Value string
+}
+
+// ParseBearerToken reads the token from an "Authorization: Bearer" header and
+// tells what kind it is.
+func ParseBearerToken(headers http.Header) (BearerToken, error) {
 	rawHeader := headers.Get("Authorization")
 	if rawHeader == "" {
-		return "", fmt.Errorf("Authorization Header Not Found")
+		return BearerToken{}, fmt.Errorf("Authorization Header Not Found")
 	}
 	token, ok := strings.CutPrefix(rawHeader, "Bearer ")
 	if !ok {
-		return "", fmt.Errorf("Header format not supported (missing 'Bearer ')")
+		return BearerToken{}, fmt.Errorf("Header format not supported (missing 'Bearer ')")
 	}
 	if token == "" {
-		return "", fmt.Errorf("Token cannot be empty")
+		return BearerToken{}, fmt.Errorf("Token cannot be empty")
 	}
-	if tokenType == "jwt" {
-		if len(token) < 100 {
-			return "", fmt.Errorf("This is a refresh token")
-		}
-	} else if tokenType == "refresh" {
-		if len(token) != 64 {
-			return "", fmt.Errorf("This is not a refresh token")
-		}
+
+	switch {
+	case strings.HasPrefix(token, RefreshTokenPrefix):
+		return BearerToken{Kind: TokenRefresh, Value: token}, nil
+	case strings.HasPrefix(token, PersonalTokenPrefix):
+		return BearerToken{Kind: TokenPersonal, Value: token}, nil
+	case strings.Count(token, ".") == 2:
+		return BearerToken{Kind: TokenAccess, Value: token}, nil
+	case isLegacyRefreshToken(token):
+		return BearerToken{Kind: TokenRefresh, Value: token}, nil
 	}
-	return token, nil
+	return BearerToken{}, fmt.Errorf("Unrecognised token format")
 }
 
+// isLegacyRefreshToken recognises the unprefixed hex refresh tokens issued
+// before tokens carried their kind, which stay valid until they expire.
+func isLegacyRefreshToken(token string) bool {
+	if len(token) != 64 && len(token) != 80 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// GetBearerToken returns the bearer token if it is of the wanted kind.
+func GetBearerToken(headers http.Header, kind TokenKind) (string, error) {
+	token, err := ParseBearerToken(headers)
+	if err != nil {
+		return "", err
+	}
+	if token.Kind != kind {
+		return "", fmt.Errorf("Expected %s token, got %s token", kind, token.Kind)
+	}
+	return token.Value, nil
+}
+
+
+// Refresh tokens are split in two: the first selectorLength characters are
+// the selector, stored as-is to look the token up, and the rest is the
+// verifier, of which only a SHA-256 digest is stored. A leaked database then
+// holds nothing that can be presented as a token. Password reset tokens are
+// built the same way.
+const selectorLength = 16
+
+type SplitToken struct {
+	// Token is what the client gets, it is never stored.
+	Token string
+	Selector string
+	VerifierHash string
+}
+
+func makeSplitToken(prefix string) (SplitToken, error) {
+	selector := make([]byte, selectorLength/2)
+	if _, err := rand.Read(selector); err != nil {
+		return SplitToken{}, err
+	}
+	verifier := make([]byte, 32)
+	if _, err := rand.Read(verifier); err != nil {
+		return SplitToken{}, err
+	}
+
+	verifierHex := hex.EncodeToString(verifier)
+	return SplitToken{
+		Token: prefix + hex.EncodeToString(selector) + verifierHex,
+		Selector: hex.EncodeToString(selector),
+		VerifierHash: HashVerifier(verifierHex),
+	}, nil
+}
+
+func MakeRefreshToken() (SplitToken, error) {
+	return makeSplitToken(RefreshTokenPrefix)
+}
+
+// ParseRefreshToken splits a token into its selector and verifier. Tokens
+// issued before hashing was introduced (64 characters) are split the same
+// way, the migration hashed their tail accordingly. Tokens issued before the
+// prefix was added are accepted without it.
+func ParseRefreshToken(token string) (selector, verifier string, err error) {
+	token = strings.TrimPrefix(token, RefreshTokenPrefix)
+	if len(token) < selectorLength + 32 {
+		return "", "", fmt.Errorf("Malformed refresh token")
+	}
+	return token[:selectorLength], token[selectorLength:], nil
+}
+
+func MakePasswordResetToken() (SplitToken, error) {
+	return makeSplitToken(PasswordResetTokenPrefix)
+}
+
+// ParsePasswordResetToken splits a reset token into its selector and
+// verifier. Unlike refresh tokens there are no legacy forms to accept.
+func ParsePasswordResetToken(token string) (selector, verifier string, err error) {
+	return parseSplitToken(token, PasswordResetTokenPrefix, "password reset")
+}
+
+func MakeEmailVerificationToken() (SplitToken, error) {
+	return makeSplitToken(EmailVerificationTokenPrefix)
+}
+
+func ParseEmailVerificationToken(token string) (selector, verifier string, err error) {
+	return parseSplitToken(token, EmailVerificationTokenPrefix, "email verification")
+}
+
+func MakePersonalAccessToken() (SplitToken, error) {
+	return makeSplitToken(PersonalTokenPrefix)
+}
+
+func ParsePersonalAccessToken(token string) (selector, verifier string, err error) {
+	return parseSplitToken(token, PersonalTokenPrefix, "personal access")
+}
+
+// MakeClientSecret issues the secret of an OAuth client. Its selector is the
+// client_id, public clients get one too and only keep the selector.
+func MakeClientSecret() (SplitToken, error) {
+	return makeSplitToken(ClientSecretPrefix)
+}
+
+func ParseClientSecret(secret string) (clientID, verifier string, err error) {
+	return parseSplitToken(secret, ClientSecretPrefix, "client secret")
+}
+
+func MakeAuthorizationCode() (SplitToken, error) {
+	return makeSplitToken(AuthorizationCodePrefix)
+}
+
+func ParseAuthorizationCode(code string) (selector, verifier string, err error) {
+	return parseSplitToken(code, AuthorizationCodePrefix, "authorization code")
+}
+
+func MakeMagicLinkToken() (SplitToken, error) {
+	return makeSplitToken(MagicLinkTokenPrefix)
+}
+
+func ParseMagicLinkToken(token string) (selector, verifier string, err error) {
+	return parseSplitToken(token, MagicLinkTokenPrefix, "login link")
+}
+
+func parseSplitToken(token, prefix, name string) (selector, verifier string, err error) {
+	token, ok := strings.CutPrefix(strings.TrimSpace(token), prefix)
+	if !ok || len(token) != selectorLength + 64 {
+		return "", "", fmt.Errorf("Malformed %s token", name)
+	}
+	return token[:selectorLength], token[selectorLength:], nil
+}
+
+func HashVerifier(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(sum[:])
+}
 
-func MakeRefreshToken() (string, error) {
-	b := make([]byte, 32)
-	rand.Read(b)
-	return hex.EncodeToString(b), nil
+// CheckVerifier compares verifier against a stored hash in constant time.
+func CheckVerifier(verifier, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashVerifier(verifier)), []byte(hash)) == 1
 }
 
 func GetAPIKey(headers http.Header) (string, error) {
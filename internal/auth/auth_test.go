@@ -2,54 +2,125 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func TestPasswords(t *testing.T) {
-	password := "banana123"
-	hash, err := HashPassword(password)
+func TestJWT(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	keys := NewHMACKeySet("banana123")
+	cfg := DefaultTokenConfig()
+	cfg.AccessTTL = 23 * time.Second
+
+	tokenString, err := MakeJWT(AccessToken{
+		UserID: userID,
+		Version: 3,
+		Scope: []string{"chirps:read", "chirps:write"},
+		ClientID: "0123456789abcdef",
+		SessionID: sessionID,
+	}, keys, cfg)
 	if err != nil {
-		t.Errorf("couldn't hash password: %v", err)
+		t.Errorf("couldn't make jwt: %v", err)
 		return
 	}
 
-	if _, err := CheckPasswordHash(password, hash); err != nil {
-		t.Errorf("couldn't match hash: %v", err)
+	currentVersion := func(uuid.UUID) (int32, error) {
+		return 3, nil
+	}
+	token, err := ValidateJWT(tokenString, keys, cfg, currentVersion)
+	if err != nil {
+		t.Errorf("couldn't validate jwt: %v", err)
+		return
+	}
+
+	if userID != token.UserID {
+		t.Errorf("id lost in translation: %v != %v", userID, token.UserID)
+		return
+	}
+	if len(token.Scope) != 2 || token.Scope[1] != "chirps:write" {
+		t.Errorf("claims lost in translation: %+v", token)
+		return
+	}
+	if token.ClientID != "0123456789abcdef" || token.SessionID != sessionID || token.ExpiresAt.Sub(token.IssuedAt) != cfg.AccessTTL {
+		t.Errorf("claims lost in translation: %+v", token)
+		return
+	}
+
+	if _, err := ValidateJWT(tokenString, NewHMACKeySet("wrong secret"), cfg, nil); err == nil {
+		t.Errorf("should've failed with the wrong secret")
+		return
+	}
+
+	bumped := func(uuid.UUID) (int32, error) {
+		return 4, nil
+	}
+	if _, err := ValidateJWT(tokenString, keys, cfg, bumped); err == nil {
+		t.Errorf("should've failed after the token version was bumped")
 		return
 	}
 }
 
-func TestJWT(t *testing.T) {
-	userID := uuid.New()
-	tokenSecret := "banana123"
-	expiresIn := 23 * time.Second
+func TestJWTConfig(t *testing.T) {
+	keys := NewHMACKeySet("banana123")
+	cfg := DefaultTokenConfig()
 
-	tokenString, err := MakeJWT(userID, tokenSecret, expiresIn)
+	other := cfg
+	other.Audience = "someone-else"
+	tokenString, err := MakeJWT(AccessToken{UserID: uuid.New()}, keys, other)
 	if err != nil {
 		t.Errorf("couldn't make jwt: %v", err)
 		return
 	}
+	if _, err := ValidateJWT(tokenString, keys, cfg, nil); err == nil {
+		t.Errorf("should've failed with the wrong audience")
+		return
+	}
 
-	newUserID, err := ValidateJWT(tokenString, tokenSecret)
+	other = cfg
+	other.Issuer = "someone-else"
+	tokenString, err = MakeJWT(AccessToken{UserID: uuid.New()}, keys, other)
 	if err != nil {
-		t.Errorf("couldn't validate jwt: %v", err)
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+	if _, err := ValidateJWT(tokenString, keys, cfg, nil); err == nil {
+		t.Errorf("should've failed with the wrong issuer")
 		return
 	}
 
-	if userID != newUserID {
-		t.Errorf("id lost in translation: %v", err)
+	// Expired a few seconds ago: within the leeway it still validates.
+	expired := cfg
+	expired.AccessTTL = -5 * time.Second
+	tokenString, err = MakeJWT(AccessToken{UserID: uuid.New()}, keys, expired)
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+	if _, err := ValidateJWT(tokenString, keys, cfg, nil); err != nil {
+		t.Errorf("should've been accepted within the leeway: %v", err)
+		return
+	}
+	strict := cfg
+	strict.Leeway = 0
+	if _, err := ValidateJWT(tokenString, keys, strict, nil); err == nil {
+		t.Errorf("should've failed once expired")
 		return
 	}
 }
 
 func TestGetBearerToken(t *testing.T) {
 	header := make(http.Header)
-	tokenString := "DSaksdhjka21sda43e_34jdsf.adas930kdd=C"
+	tokenString, err := MakeJWT(AccessToken{UserID: uuid.New()}, NewHMACKeySet("banana123"), DefaultTokenConfig())
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
 	header.Add("Authorization", "Bearer " + tokenString)
-	token, err := GetBearerToken(header, "jwt") 
+	token, err := GetBearerToken(header, TokenAccess)
 	if err != nil {
 		t.Errorf("couldn't get bearer token: %v", err)
 		return
@@ -61,7 +132,7 @@ func TestGetBearerToken(t *testing.T) {
 
 	tokenString = ""
 	header.Set("Authorization", "Bearer " + tokenString)
-	token, err = GetBearerToken(header, "jwt") 
+	token, err = GetBearerToken(header, TokenAccess)
 	if err == nil {
 		t.Errorf("should've errored with empty token")
 		return
@@ -69,8 +140,257 @@ func TestGetBearerToken(t *testing.T) {
 
 
 	header.Del("Authorization")
-	if _, err := GetBearerToken(header, "jwt"); err == nil {
+	if _, err := GetBearerToken(header, TokenAccess); err == nil {
 		t.Errorf("should've failed with no Authorization header")
 		return
 	}
 }
+
+func TestBearerTokenKinds(t *testing.T) {
+	access, err := MakeJWT(AccessToken{UserID: uuid.New()}, NewHMACKeySet("banana123"), DefaultTokenConfig())
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+	refresh, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("couldn't make refresh token: %v", err)
+		return
+	}
+
+	cases := map[string]TokenKind{
+		access: TokenAccess,
+		refresh.Token: TokenRefresh,
+		strings.TrimPrefix(refresh.Token, RefreshTokenPrefix): TokenRefresh,
+		PersonalTokenPrefix + "abcdef": TokenPersonal,
+	}
+	for token, kind := range cases {
+		header := make(http.Header)
+		header.Set("Authorization", "Bearer " + token)
+		parsed, err := ParseBearerToken(header)
+		if err != nil {
+			t.Errorf("couldn't parse %q: %v", token, err)
+			continue
+		}
+		if parsed.Kind != kind {
+			t.Errorf("%q: expected %s, got %s", token, kind, parsed.Kind)
+		}
+	}
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer " + refresh.Token)
+	if _, err := GetBearerToken(header, TokenAccess); err == nil {
+		t.Errorf("a refresh token shouldn't be accepted as an access token")
+	}
+	header.Set("Authorization", "Bearer not-a-token")
+	if _, err := ParseBearerToken(header); err == nil {
+		t.Errorf("should've failed with an unrecognised token")
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	refresh, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("couldn't make refresh token: %v", err)
+		return
+	}
+
+	selector, verifier, err := ParseRefreshToken(refresh.Token)
+	if err != nil {
+		t.Errorf("couldn't parse refresh token: %v", err)
+		return
+	}
+	if selector != refresh.Selector {
+		t.Errorf("selectors don't match: %v != %v", selector, refresh.Selector)
+		return
+	}
+	if !CheckVerifier(verifier, refresh.VerifierHash) {
+		t.Errorf("verifier doesn't match its own hash")
+		return
+	}
+	if CheckVerifier(verifier + "0", refresh.VerifierHash) {
+		t.Errorf("tampered verifier shouldn't match")
+		return
+	}
+
+	if _, _, err := ParseRefreshToken("tooshort"); err == nil {
+		t.Errorf("should've failed with a short token")
+		return
+	}
+}
+
+func TestPasswordResetToken(t *testing.T) {
+	reset, err := MakePasswordResetToken()
+	if err != nil {
+		t.Errorf("couldn't make password reset token: %v", err)
+		return
+	}
+
+	selector, verifier, err := ParsePasswordResetToken(reset.Token)
+	if err != nil {
+		t.Errorf("couldn't parse password reset token: %v", err)
+		return
+	}
+	if selector != reset.Selector || !CheckVerifier(verifier, reset.VerifierHash) {
+		t.Errorf("password reset token doesn't match its own parts")
+		return
+	}
+
+	refresh, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("couldn't make refresh token: %v", err)
+		return
+	}
+	if _, _, err := ParsePasswordResetToken(refresh.Token); err == nil {
+		t.Errorf("a refresh token shouldn't parse as a password reset token")
+		return
+	}
+	if _, _, err := ParsePasswordResetToken(reset.Token[:len(reset.Token) - 1]); err == nil {
+		t.Errorf("should've failed with a truncated token")
+		return
+	}
+
+	verification, err := MakeEmailVerificationToken()
+	if err != nil {
+		t.Errorf("couldn't make email verification token: %v", err)
+		return
+	}
+	if _, _, err := ParsePasswordResetToken(verification.Token); err == nil {
+		t.Errorf("an email verification token shouldn't parse as a password reset token")
+		return
+	}
+	if selector, _, err := ParseEmailVerificationToken(verification.Token); err != nil || selector != verification.Selector {
+		t.Errorf("couldn't parse email verification token: %v", err)
+	}
+}
+
+func TestMagicLinkToken(t *testing.T) {
+	link, err := MakeMagicLinkToken()
+	if err != nil {
+		t.Errorf("couldn't make login link token: %v", err)
+		return
+	}
+
+	selector, verifier, err := ParseMagicLinkToken(link.Token)
+	if err != nil {
+		t.Errorf("couldn't parse login link token: %v", err)
+		return
+	}
+	if selector != link.Selector || !CheckVerifier(verifier, link.VerifierHash) {
+		t.Errorf("login link token doesn't match its own parts")
+		return
+	}
+
+	reset, err := MakePasswordResetToken()
+	if err != nil {
+		t.Errorf("couldn't make password reset token: %v", err)
+		return
+	}
+	if _, _, err := ParseMagicLinkToken(reset.Token); err == nil {
+		t.Errorf("a password reset token shouldn't parse as a login link token")
+		return
+	}
+	if _, _, err := ParsePasswordResetToken(link.Token); err == nil {
+		t.Errorf("a login link token shouldn't parse as a password reset token")
+		return
+	}
+	if _, _, err := ParseMagicLinkToken(link.Token[:len(link.Token) - 1]); err == nil {
+		t.Errorf("should've failed with a truncated token")
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	pat, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Errorf("couldn't make personal access token: %v", err)
+		return
+	}
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer " + pat.Token)
+	bearer, err := ParseBearerToken(header)
+	if err != nil || bearer.Kind != TokenPersonal {
+		t.Errorf("expected a personal access token, got %v (%v)", bearer.Kind, err)
+		return
+	}
+	selector, verifier, err := ParsePersonalAccessToken(bearer.Value)
+	if err != nil {
+		t.Errorf("couldn't parse personal access token: %v", err)
+		return
+	}
+	if selector != pat.Selector || !CheckVerifier(verifier, pat.VerifierHash) {
+		t.Errorf("personal access token doesn't match its own parts")
+		return
+	}
+
+	refresh, err := MakeRefreshToken()
+	if err != nil {
+		t.Errorf("couldn't make refresh token: %v", err)
+		return
+	}
+	if _, _, err := ParsePersonalAccessToken(refresh.Token); err == nil {
+		t.Errorf("a refresh token shouldn't parse as a personal access token")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
+	if err != nil {
+		t.Errorf("couldn't parse scopes: %v", err)
+		return
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeChirpsWrite || scopes[1] != ScopeChirpsRead {
+		t.Errorf("unexpected scopes: %v", scopes)
+		return
+	}
+	if _, err := ParseScopes([]string{"chirps:admin"}); err == nil {
+		t.Errorf("should've failed with an unknown scope")
+		return
+	}
+
+	cases := []struct {
+		granted []string
+		required string
+		want bool
+	}{
+		{nil, ScopeProfileWrite, true},
+		{[]string{ScopeChirpsRead}, ScopeChirpsRead, true},
+		{[]string{ScopeChirpsRead}, ScopeChirpsWrite, false},
+		{[]string{ScopeChirpsWrite}, ScopeChirpsRead, false},
+	}
+	for _, c := range cases {
+		if got := HasScope(c.granted, c.required); got != c.want {
+			t.Errorf("HasScope(%v, %s) = %v, expected %v", c.granted, c.required, got, c.want)
+		}
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	keys := NewHMACKeySet("banana123")
+	cfg := DefaultTokenConfig()
+	userID := uuid.New()
+
+	mfaToken, err := MakeMFAToken(userID, 2, keys, cfg)
+	if err != nil {
+		t.Errorf("couldn't make mfa token: %v", err)
+		return
+	}
+	gotID, version, err := ValidateMFAToken(mfaToken, keys, cfg)
+	if err != nil || gotID != userID || version != 2 {
+		t.Errorf("couldn't validate mfa token: %v", err)
+		return
+	}
+	if _, err := ValidateJWT(mfaToken, keys, cfg, nil); err == nil {
+		t.Errorf("an mfa token shouldn't be accepted as an access token")
+		return
+	}
+
+	access, err := MakeJWT(AccessToken{UserID: userID}, keys, cfg)
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+	if _, _, err := ValidateMFAToken(access, keys, cfg); err == nil {
+		t.Errorf("an access token shouldn't be accepted as an mfa token")
+	}
+}
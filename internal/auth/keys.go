@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one signing or verification key. Keys loaded from a private key can
+// sign and verify, keys loaded from a public key only verify: that is how a
+// retired key keeps validating the tokens it signed until they expire.
+type Key struct {
+	ID string
+	method jwt.SigningMethod
+	private any
+	public any
+}
+
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// KeySet holds every key access tokens may be verified with and the one new
+// tokens are signed with.
+type KeySet struct {
+	signing *Key
+	keys map[string]*Key
+	// hmac verifies tokens without a kid header, as issued before
+	// asymmetric keys, or signs them when no key directory is configured.
+	hmac *Key
+	// hmacUntil is when hmac stops verifying, zero when it signs too.
+	hmacUntil time.Time
+}
+
+func hmacKey(secret string) *Key {
+	return &Key{
+		method: jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public: []byte(secret),
+	}
+}
+
+// NewHMACKeySet signs and verifies with a single HS256 shared secret.
+func NewHMACKeySet(secret string) *KeySet {
+	ks := &KeySet{keys: map[string]*Key{}, hmac: hmacKey(secret)}
+	ks.signing = ks.hmac
+	return ks
+}
+
+// AddHMAC lets the set verify HS256 tokens without a kid header until the
+// time until, so tokens issued before switching to asymmetric keys stay
+// valid until they expire. After that, whoever still holds the secret could
+// only be forging tokens, so they are refused.
+func (ks *KeySet) AddHMAC(secret string, until time.Time) {
+	ks.hmac = hmacKey(secret)
+	ks.hmacUntil = until
+}
+
+// LoadKeySet reads every *.pem file in dir. The file name without extension
+// is the key ID. Supported are PKCS#8 Ed25519 and RSA private keys, PKCS#1
+// RSA private keys and PKIX public keys. signingKeyID picks the key new tokens
+// are signed with; it may be empty when dir holds exactly one private key.
+func LoadKeySet(dir, signingKeyID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	ks := &KeySet{keys: map[string]*Key{}}
+	var private []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.keys[id] = key
+		if key.CanSign() {
+			private = append(private, key)
+		}
+	}
+
+	switch {
+	case signingKeyID != "":
+		key, ok := ks.keys[signingKeyID]
+		if !ok || !key.CanSign() {
+			return nil, fmt.Errorf("no private key %q in %s", signingKeyID, dir)
+		}
+		ks.signing = key
+	case len(private) == 1:
+		ks.signing = private[0]
+	case len(private) == 0:
+		return nil, fmt.Errorf("no private key in %s", dir)
+	default:
+		return nil, fmt.Errorf("%s holds several private keys, pick one with a signing key id", dir)
+	}
+	return ks, nil
+}
+
+// ParseKey parses a single PEM encoded key.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.private = k
+		key.public = k.Public()
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.public = k
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+		key.private = k
+		key.public = &k.PublicKey
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+		key.public = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if pub, ok := key.public.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := ks.signing
+	if key == nil {
+		return "", fmt.Errorf("no signing key configured")
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.private)
+}
+
+// keyFunc picks the verification key for a token by its kid header and
+// refuses tokens whose algorithm doesn't match that key.
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	key := ks.hmac
+	if kid, ok := t.Header["kid"].(string); ok {
+		key = ks.keys[kid]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+	if key == ks.hmac && !ks.hmacUntil.IsZero() && time.Now().After(ks.hmacUntil) {
+		return nil, fmt.Errorf("HS256 tokens are no longer accepted")
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("incorrect method")
+	}
+	return key.public, nil
+}
+
+// JWK is the public part of a key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X string `json:"x,omitempty"`
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys of the set, HMAC secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := JWK{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Algorithm(),
+		}
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
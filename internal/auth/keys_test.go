@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writePEM(dir, name, blockType string, der []byte) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return os.WriteFile(filepath.Join(dir, name + ".pem"), data, 0600)
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Errorf("couldn't generate key: %v", err)
+		return
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Errorf("couldn't marshal key: %v", err)
+		return
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Errorf("couldn't marshal key: %v", err)
+		return
+	}
+
+	oldDir := t.TempDir()
+	if err := writePEM(oldDir, "2024-01", "PRIVATE KEY", privDER); err != nil {
+		t.Errorf("couldn't write key: %v", err)
+		return
+	}
+	oldKeys, err := LoadKeySet(oldDir, "")
+	if err != nil {
+		t.Errorf("couldn't load keys: %v", err)
+		return
+	}
+	oldToken, err := MakeJWT(AccessToken{UserID: userID}, oldKeys, DefaultTokenConfig())
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+
+	// Rotate: a new RSA signing key, the old key kept for verification only.
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Errorf("couldn't generate key: %v", err)
+		return
+	}
+	newDir := t.TempDir()
+	if err := writePEM(newDir, "2024-01", "PUBLIC KEY", pubDER); err != nil {
+		t.Errorf("couldn't write key: %v", err)
+		return
+	}
+	if err := writePEM(newDir, "2024-06", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)); err != nil {
+		t.Errorf("couldn't write key: %v", err)
+		return
+	}
+	newKeys, err := LoadKeySet(newDir, "")
+	if err != nil {
+		t.Errorf("couldn't load keys: %v", err)
+		return
+	}
+	newToken, err := MakeJWT(AccessToken{UserID: userID}, newKeys, DefaultTokenConfig())
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		if got, err := ValidateJWT(token, newKeys, DefaultTokenConfig(), nil); err != nil || got.UserID != userID {
+			t.Errorf("couldn't validate jwt after rotation: %v", err)
+		}
+	}
+	if _, err := ValidateJWT(newToken, oldKeys, DefaultTokenConfig(), nil); err == nil {
+		t.Errorf("should've failed with an unknown kid")
+	}
+
+	jwks := newKeys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Errorf("expected 2 keys in the JWKS, got %d", len(jwks.Keys))
+		return
+	}
+	if jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Alg != "EdDSA" || jwks.Keys[1].Kty != "RSA" || jwks.Keys[1].Alg != "RS256" {
+		t.Errorf("unexpected JWKS: %+v", jwks)
+	}
+}
+
+func TestHMACFallback(t *testing.T) {
+	userID := uuid.New()
+	legacy := NewHMACKeySet("banana123")
+	legacyToken, err := MakeJWT(AccessToken{UserID: userID}, legacy, DefaultTokenConfig())
+	if err != nil {
+		t.Errorf("couldn't make jwt: %v", err)
+		return
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Errorf("couldn't generate key: %v", err)
+		return
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Errorf("couldn't marshal key: %v", err)
+		return
+	}
+	dir := t.TempDir()
+	if err := writePEM(dir, "main", "PRIVATE KEY", der); err != nil {
+		t.Errorf("couldn't write key: %v", err)
+		return
+	}
+	keys, err := LoadKeySet(dir, "main")
+	if err != nil {
+		t.Errorf("couldn't load keys: %v", err)
+		return
+	}
+
+	if _, err := ValidateJWT(legacyToken, keys, DefaultTokenConfig(), nil); err == nil {
+		t.Errorf("should've failed without the HMAC secret")
+	}
+	keys.AddHMAC("banana123", time.Now().Add(time.Hour))
+	if _, err := ValidateJWT(legacyToken, keys, DefaultTokenConfig(), nil); err != nil {
+		t.Errorf("couldn't validate legacy jwt: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 1 {
+		t.Errorf("the HMAC secret must not be published")
+	}
+
+	keys.AddHMAC("banana123", time.Now().Add(-time.Second))
+	if _, err := ValidateJWT(legacyToken, keys, DefaultTokenConfig(), nil); err == nil {
+		t.Errorf("should've failed after the HMAC secret's deadline")
+	}
+
+	if _, err := LoadKeySet(dir, "missing"); err == nil {
+		t.Errorf("should've failed with an unknown signing key id")
+	}
+}
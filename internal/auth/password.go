@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParams are the Argon2id cost parameters new password hashes are
+// made with. Every hash records its own parameters, so changing them only
+// affects new hashes; NeedsRehash tells which old ones to upgrade.
+type PasswordParams struct {
+	// Memory is in KiB.
+	Memory uint32
+	Iterations uint32
+	Parallelism uint8
+}
+
+const (
+	passwordSaltLength = 16
+	passwordKeyLength = 32
+)
+
+// DefaultPasswordParams are the parameters chirpy always used before they
+// were configurable, so existing hashes don't all need a rehash.
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Memory: argon2id.DefaultParams.Memory,
+		Iterations: argon2id.DefaultParams.Iterations,
+		Parallelism: argon2id.DefaultParams.Parallelism,
+	}
+}
+
+// Validate checks the parameters are ones Argon2id can run with.
+func (p PasswordParams) Validate() error {
+	if p.Iterations < 1 {
+		return fmt.Errorf("Argon2id needs at least one iteration")
+	}
+	if p.Parallelism < 1 {
+		return fmt.Errorf("Argon2id needs a parallelism of at least one")
+	}
+	if p.Memory < 8 * uint32(p.Parallelism) {
+		return fmt.Errorf("Argon2id needs at least 8 KiB of memory per lane")
+	}
+	return nil
+}
+
+func (p PasswordParams) argon2id() *argon2id.Params {
+	return &argon2id.Params{
+		Memory: p.Memory,
+		Iterations: p.Iterations,
+		Parallelism: p.Parallelism,
+		SaltLength: passwordSaltLength,
+		KeyLength: passwordKeyLength,
+	}
+}
+
+func HashPassword(password string, params PasswordParams) (string, error) {
+	hash, err := argon2id.CreateHash(password, params.argon2id())
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func CheckPasswordHash(password, hash string) (bool, error) {
+	check, err := argon2id.ComparePasswordAndHash(password, hash)
+	return check, err
+}
+
+// NeedsRehash reports whether hash was made with parameters other than
+// params. Rehashing is only possible with the password at hand, i.e. right
+// after a successful login.
+func NeedsRehash(hash string, params PasswordParams) (bool, error) {
+	got, salt, key, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return got.Memory != params.Memory ||
+		got.Iterations != params.Iterations ||
+		got.Parallelism != params.Parallelism ||
+		len(salt) != passwordSaltLength ||
+		len(key) != passwordKeyLength, nil
+}
+
+const (
+	minCalibrationMemory = 16 * 1024
+	maxCalibrationIterations = 20
+)
+
+// CalibratePasswordParams picks parameters for which measure, the time one
+// hash takes, reaches target. Memory is raised first, doubling up to
+// maxMemory, since it is what makes guessing on GPUs expensive; iterations
+// are added after that.
+func CalibratePasswordParams(target time.Duration, maxMemory uint32, parallelism uint8, measure func(PasswordParams) time.Duration) PasswordParams {
+	p := PasswordParams{
+		Memory: min(minCalibrationMemory, maxMemory),
+		Iterations: 1,
+		Parallelism: parallelism,
+	}
+	took := measure(p)
+	for took < target && p.Memory * 2 <= maxMemory {
+		p.Memory *= 2
+		took = measure(p)
+	}
+	for took < target && p.Iterations < maxCalibrationIterations {
+		p.Iterations++
+		took = measure(p)
+	}
+	return p
+}
+
+// MeasurePasswordParams is the median time of rounds hashes with params.
+func MeasurePasswordParams(params PasswordParams, rounds int) (time.Duration, error) {
+	times := make([]time.Duration, 0, rounds)
+	for range rounds {
+		start := time.Now()
+		if _, err := HashPassword("calibration", params); err != nil {
+			return 0, err
+		}
+		times = append(times, time.Since(start))
+	}
+	if len(times) == 0 {
+		return 0, fmt.Errorf("rounds must be at least 1")
+	}
+	slices.Sort(times)
+	return times[len(times) / 2], nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// cheapParams keep the tests fast; real deployments use far more memory.
+var cheapParams = PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestPasswords(t *testing.T) {
+	password := "banana123"
+	hash, err := HashPassword(password, cheapParams)
+	if err != nil {
+		t.Errorf("couldn't hash password: %v", err)
+		return
+	}
+
+	if ok, err := CheckPasswordHash(password, hash); err != nil || !ok {
+		t.Errorf("couldn't match hash: %v", err)
+		return
+	}
+	if ok, _ := CheckPasswordHash("banana124", hash); ok {
+		t.Errorf("wrong password shouldn't match")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := HashPassword("banana123", cheapParams)
+	if err != nil {
+		t.Errorf("couldn't hash password: %v", err)
+		return
+	}
+
+	if rehash, err := NeedsRehash(hash, cheapParams); err != nil || rehash {
+		t.Errorf("hash made with the current params shouldn't need a rehash: %v", err)
+		return
+	}
+	stronger := cheapParams
+	stronger.Iterations = 2
+	if rehash, err := NeedsRehash(hash, stronger); err != nil || !rehash {
+		t.Errorf("hash made with old params should need a rehash: %v", err)
+		return
+	}
+	if _, err := NeedsRehash("$2a$10$notargon", cheapParams); err == nil {
+		t.Errorf("should've failed on a hash that isn't Argon2id")
+	}
+}
+
+func TestPasswordParamsValidate(t *testing.T) {
+	if err := DefaultPasswordParams().Validate(); err != nil {
+		t.Errorf("default params should be valid: %v", err)
+		return
+	}
+	for _, p := range []PasswordParams{
+		{Memory: 1024, Iterations: 0, Parallelism: 1},
+		{Memory: 1024, Iterations: 1, Parallelism: 0},
+		{Memory: 16, Iterations: 1, Parallelism: 4},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", p)
+		}
+	}
+}
+
+func TestCalibratePasswordParams(t *testing.T) {
+	// A made up machine where a hash takes a millisecond per MiB and iteration.
+	measure := func(p PasswordParams) time.Duration {
+		return time.Duration(p.Memory / 1024 * p.Iterations) * time.Millisecond
+	}
+
+	p := CalibratePasswordParams(100 * time.Millisecond, 256 * 1024, 2, measure)
+	if p.Memory != 128 * 1024 || p.Iterations != 1 || p.Parallelism != 2 {
+		t.Errorf("expected 128 MiB and one iteration, got %+v", p)
+		return
+	}
+
+	p = CalibratePasswordParams(200 * time.Millisecond, 64 * 1024, 2, measure)
+	if p.Memory != 64 * 1024 || p.Iterations != 4 {
+		t.Errorf("expected 64 MiB and four iterations once memory is capped, got %+v", p)
+	}
+}
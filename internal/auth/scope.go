@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Scopes restrict what a token may be used for. Personal access tokens
+// always carry at least one; access tokens from a login carry none and are
+// not restricted.
+const (
+	ScopeChirpsRead = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeProfileRead = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+var knownScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileRead, ScopeProfileWrite}
+
+// ParseScopes checks every scope is known and drops duplicates, keeping the
+// order they were given in.
+func ParseScopes(scopes []string) ([]string, error) {
+	parsed := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return nil, fmt.Errorf("Unknown scope %q", scope)
+		}
+		if !slices.Contains(parsed, scope) {
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed, nil
+}
+
+// HasScope reports whether a token granted scopes may be used where required
+// is needed. No scopes at all means an unrestricted token.
+func HasScope(granted []string, required string) bool {
+	return len(granted) == 0 || slices.Contains(granted, required)
+}
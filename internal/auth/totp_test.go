@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, appendix B, cut to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := map[int64]string{
+		59: "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Errorf("couldn't compute code: %v", err)
+			return
+		}
+		if got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Errorf("couldn't generate secret: %v", err)
+		return
+	}
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPStep(now))
+	if err != nil {
+		t.Errorf("couldn't compute code: %v", err)
+		return
+	}
+
+	step, ok := CheckTOTP(secret, code, now)
+	if !ok || step != TOTPStep(now) {
+		t.Errorf("current code should be accepted")
+		return
+	}
+	if _, ok := CheckTOTP(secret, code, now.Add(totpPeriod * time.Second)); !ok {
+		t.Errorf("code from one step ago should be accepted")
+		return
+	}
+	if _, ok := CheckTOTP(secret, code, now.Add(3 * totpPeriod * time.Second)); ok {
+		t.Errorf("code from three steps ago should be refused")
+		return
+	}
+	if _, ok := CheckTOTP(secret, "12345", now); ok {
+		t.Errorf("short code should be refused")
+		return
+	}
+
+	uri := TOTPURI(secret, "chirpy", "walt@breakingbad.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/chirpy:walt@breakingbad.com?") || !strings.Contains(uri, "secret=" + secret) {
+		t.Errorf("unexpected otpauth URI: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Errorf("couldn't make recovery codes: %v", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != recoveryCodeLength + 1 || code[5] != '-' {
+			t.Errorf("unexpected recovery code format: %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("recovery codes should be unique")
+	}
+
+	code := codes[0]
+	if HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != HashRecoveryCode(code) {
+		t.Errorf("recovery codes should match without the dash and in any case")
+	}
+}
@@ -0,0 +1,65 @@
+// Package breach looks passwords up in a local copy of a breached password
+// corpus, laid out like the Pwned Passwords range API: the uppercase hex
+// SHA-1 of every password is split after five characters, and the file named
+// after the prefix lists the remaining 35 characters of each hash, one per
+// line, optionally followed by ":<count>".
+//
+//	<dir>/5BAA6:
+//	1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+//	...
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+type Corpus struct {
+	dir string
+}
+
+func Open(dir string) (*Corpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s isn't a directory", dir)
+	}
+	return &Corpus{dir: dir}, nil
+}
+
+// Contains reports whether password is in the corpus. Only the file for its
+// hash prefix is read; a missing file means no breached password has it.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
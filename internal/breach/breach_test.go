@@ -0,0 +1,44 @@
+package breach
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCorpus(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	lines := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" +
+		"1e4c9b93f3f0682250b6cf8331b7ee68fd8:3861493\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(lines), 0o600); err != nil {
+		t.Errorf("couldn't write corpus: %v", err)
+		return
+	}
+
+	corpus, err := Open(dir)
+	if err != nil {
+		t.Errorf("couldn't open corpus: %v", err)
+		return
+	}
+
+	cases := map[string]bool{
+		"password": true,
+		"Password": false,
+		"correct horse battery staple": false,
+	}
+	for password, want := range cases {
+		got, err := corpus.Contains(password)
+		if err != nil {
+			t.Errorf("%q: %v", password, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Contains(%q) = %v, want %v", password, got, want)
+		}
+	}
+
+	if _, err := Open(filepath.Join(dir, "5BAA6")); err == nil {
+		t.Errorf("opening a file as the corpus should fail")
+	}
+}
@@ -6,33 +6,245 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Event     string
+	ActorID   uuid.NullUUID
+	UserID    uuid.NullUUID
+	Ip        string
+	UserAgent string
+	Metadata  json.RawMessage
+}
+
+type BannedTerm struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Term      string
+	MatchType string
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	HiddenAt  sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type EmailVerificationToken struct {
+	ID        string
+	TokenHash string
 	CreatedAt time.Time
-	UpdatedAt time.Time
 	UserID    uuid.UUID
+	Email     string
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
 }
 
-type User struct {
+type LoginThrottle struct {
+	Kind          string
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MagicLink struct {
+	ID          string
+	TokenHash   string
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	BrowserHash string
+	ExpiresAt   time.Time
+}
+
+type ModerationLog struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	ModeratorID   uuid.NullUUID
+	Action        string
+	TargetUserID  uuid.NullUUID
+	TargetChirpID uuid.NullUUID
+	ReportID      uuid.NullUUID
+	Note          string
+}
+
+type MutedWord struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	UserID            uuid.UUID
+	Phrase            string
+	Action            string
+	MuteHome          bool
+	MuteNotifications bool
+	MuteSearch        bool
+	ExpiresAt         sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	ID            string
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scope         string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           string
+	SecretHash   sql.NullString
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	RedirectUris string
+	Scope        string
+}
+
+type OidcLogin struct {
+	ID           string
+	CreatedAt    time.Time
+	Nonce        string
+	CodeVerifier string
+	BrowserHash  string
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	ID        string
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type PersonalAccessToken struct {
+	ID         string
+	TokenHash  string
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	Scope      string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	ID         string
+	TokenHash  string
+	UserAgent  string
+	Ip         string
+	LastUsedAt time.Time
+	ClientID   sql.NullString
+	Scope      string
+}
+
+type Report struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ReporterID     uuid.UUID
+	ReportedUserID uuid.UUID
+	ChirpID        uuid.NullUUID
+	Reason         string
+	Details        string
+	Status         string
+	ResolvedAt     sql.NullTime
+}
+
+type Role struct {
+	Name        string
+	Description string
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
+}
+
+type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	SuspendedUntil  sql.NullTime
+	ShadowBanned    bool
+	TokenVersion    int32
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastStep    int64
+	EmailVerifiedAt sql.NullTime
+	Role            string
+}
+
+type UserIdentity struct {
+	Issuer      string
+	Subject     string
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Email       string
+	LastLoginAt time.Time
+}
+
+type UserWarning struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ReportID  uuid.NullUUID
+	Message   string
+}
+
+type WebauthnCeremony struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.NullUUID
+	Kind      string
+	Session   json.RawMessage
+	ExpiresAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	CredentialID []byte
+	Credential   json.RawMessage
+	Name         string
+	LastUsedAt   sql.NullTime
 }
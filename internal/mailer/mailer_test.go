@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	msg := Message{
+		To: "walt@breakingbad.com",
+		Subject: "Réinitialiser",
+		Body: "line one\nline two",
+	}
+	data, err := render("Chirpy <chirpy@example.com>", msg, time.Unix(0, 0).UTC())
+	if err != nil {
+		t.Errorf("couldn't render message: %v", err)
+		return
+	}
+	rendered := string(data)
+	for _, want := range []string{
+		"From: Chirpy <chirpy@example.com>\r\n",
+		"To: walt@breakingbad.com\r\n",
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("rendered message is missing %q:\n%s", want, rendered)
+		}
+	}
+
+	cases := map[string]Message{
+		"injected header": {To: "walt@breakingbad.com", Subject: "hi\r\nBcc: jesse@breakingbad.com"},
+		"injected recipient": {To: "walt@breakingbad.com\nBcc: jesse@breakingbad.com", Subject: "hi"},
+		"bad recipient": {To: "not an address", Subject: "hi"},
+	}
+	for name, msg := range cases {
+		if _, err := render("chirpy@example.com", msg, time.Now()); err == nil {
+			t.Errorf("%s: should've been refused", name)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	m := File{Dir: filepath.Join(dir, "mail"), From: "chirpy@example.com"}
+	for range 2 {
+		err := m.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "hi", Body: "hello"})
+		if err != nil {
+			t.Errorf("couldn't send: %v", err)
+			return
+		}
+	}
+
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		t.Errorf("couldn't read mail directory: %v", err)
+		return
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(entries))
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(m.Dir, entries[0].Name()))
+	if err != nil {
+		t.Errorf("couldn't read message: %v", err)
+		return
+	}
+	if !strings.HasSuffix(entries[0].Name(), ".eml") || !strings.Contains(string(data), "hello") {
+		t.Errorf("unexpected message file %s: %s", entries[0].Name(), data)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := &Memory{}
+	if err := m.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "hi"}); err != nil {
+		t.Errorf("couldn't send: %v", err)
+		return
+	}
+	if err := m.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "a\nb"}); err == nil {
+		t.Errorf("a message that can't be delivered shouldn't be kept")
+		return
+	}
+
+	sent := m.Messages()
+	if len(sent) != 1 || sent[0].Subject != "hi" {
+		t.Errorf("unexpected messages: %v", sent)
+	}
+}
@@ -0,0 +1,51 @@
+package moderation
+
+import (
+	"context"
+	"sync"
+)
+
+// Cache keeps the Filter built from the banned terms in memory. The rules are
+// loaded lazily on first use and again after every Invalidate, which the
+// admin endpoints call whenever they change a term.
+type Cache struct {
+	mu sync.RWMutex
+	filter *Filter
+	load func(context.Context) ([]Rule, error)
+}
+
+func NewCache(load func(context.Context) ([]Rule, error)) *Cache {
+	return &Cache{load: load}
+}
+
+func (c *Cache) Filter(ctx context.Context) (*Filter, error) {
+	c.mu.RLock()
+	f := c.filter
+	c.mu.RUnlock()
+	if f != nil {
+		return f, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filter != nil {
+		return c.filter, nil
+	}
+
+	rules, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err = NewFilter(rules)
+	if err != nil {
+		return nil, err
+	}
+	c.filter = f
+	return f, nil
+}
+
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.filter = nil
+	c.mu.Unlock()
+}
@@ -0,0 +1,206 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MatchType decides how a banned term is compared against a chirp.
+type MatchType string
+
+const (
+	// MatchWord only matches whole words, so "fornax" hides "Fornax!" but
+	// not "fornaxes". Terms with several words match them in sequence.
+	MatchWord MatchType = "word"
+	// MatchSubstring matches the term anywhere inside a word and masks the
+	// whole word.
+	MatchSubstring MatchType = "substring"
+	// MatchRegex runs the term as a regular expression over the lowercased
+	// text with accents removed, and masks exactly what it matched. Unlike
+	// the other match types it doesn't undo leetspeak or look-alike letters:
+	// the regex sees digits and symbols as typed.
+	MatchRegex MatchType = "regex"
+)
+
+const mask = "****"
+
+type Rule struct {
+	Term string
+	Match MatchType
+}
+
+// Validate reports whether the rule could be compiled into a Filter.
+func (r Rule) Validate() error {
+	switch r.Match {
+	case MatchWord, MatchSubstring:
+		if len(foldTerm(r.Term)) == 0 {
+			return fmt.Errorf("term must contain at least one letter or digit")
+		}
+		return nil
+	case MatchRegex:
+		if r.Term == "" {
+			return fmt.Errorf("term cannot be empty")
+		}
+		_, err := regexp.Compile(r.Term)
+		return err
+	}
+	return fmt.Errorf("unknown match type %q", r.Match)
+}
+
+type compiledRule struct {
+	Rule
+	words []string
+	re *regexp.Regexp
+}
+
+// Filter masks banned terms in chirps. It is immutable once built and safe
+// for concurrent use.
+type Filter struct {
+	rules []compiledRule
+}
+
+func NewFilter(rules []Rule) (*Filter, error) {
+	f := &Filter{}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("banned term %q: %w", r.Term, err)
+		}
+		c := compiledRule{Rule: r}
+		if r.Match == MatchRegex {
+			c.re = regexp.MustCompile(r.Term)
+		} else {
+			c.words = foldTerm(r.Term)
+		}
+		f.rules = append(f.rules, c)
+	}
+	return f, nil
+}
+
+// Clean returns body with every banned term replaced by "****".
+func (f *Filter) Clean(body string) string {
+	spans, _ := f.find(body)
+	if len(spans) == 0 {
+		return body
+	}
+
+	text := fold(body)
+	out := strings.Builder{}
+	last := 0
+	for _, s := range spans {
+		from, to := text.start[s.from], text.end[s.to - 1]
+		out.WriteString(body[last:from])
+		out.WriteString(mask)
+		last = to
+	}
+	out.WriteString(body[last:])
+	return out.String()
+}
+
+// Matches returns the rules that matched body, each at most once.
+func (f *Filter) Matches(body string) []Rule {
+	_, rules := f.find(body)
+	return rules
+}
+
+func (f *Filter) find(body string) ([]span, []Rule) {
+	if f == nil || len(f.rules) == 0 {
+		return nil, nil
+	}
+
+	text := fold(body)
+	tokens := text.tokens()
+	var plain folded
+	var spans []span
+	var matched []Rule
+
+	for _, r := range f.rules {
+		var found []span
+		switch r.Match {
+		case MatchWord:
+			found = matchWords(text, tokens, r.words)
+		case MatchSubstring:
+			found = matchSubstring(text, tokens, strings.Join(r.words, ""))
+		case MatchRegex:
+			if plain.runes == nil {
+				plain = lower(body)
+			}
+			found = matchRegex(plain, r.re)
+		}
+		if len(found) > 0 {
+			spans = append(spans, found...)
+			matched = append(matched, r.Rule)
+		}
+	}
+
+	return mergeSpans(spans), matched
+}
+
+func matchWords(text folded, tokens []span, words []string) []span {
+	var out []span
+	for i := 0; i + len(words) <= len(tokens); i++ {
+		ok := true
+		for j, w := range words {
+			if text.text(tokens[i+j]) != w {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, span{tokens[i].from, tokens[i + len(words) - 1].to})
+		}
+	}
+	return out
+}
+
+func matchSubstring(text folded, tokens []span, term string) []span {
+	var out []span
+	for _, t := range tokens {
+		if strings.Contains(text.text(t), term) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func matchRegex(text folded, re *regexp.Regexp) []span {
+	s := string(text.runes)
+
+	// Regexp reports byte offsets into s, spans are rune indices.
+	runeAt := make([]int, len(s) + 1)
+	n := 0
+	for i := range s {
+		runeAt[i] = n
+		n++
+	}
+	runeAt[len(s)] = n
+
+	var out []span
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		out = append(out, span{runeAt[m[0]], runeAt[m[1]]})
+	}
+	return out
+}
+
+func mergeSpans(spans []span) []span {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].from < spans[j].from
+	})
+	out := []span{spans[0]}
+	for _, s := range spans[1:] {
+		last := &out[len(out) - 1]
+		if s.from <= last.to {
+			last.to = max(last.to, s.to)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
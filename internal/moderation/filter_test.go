@@ -0,0 +1,122 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFilterClean(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Term: "kerfuffle", Match: MatchWord},
+		{Term: "sharbert", Match: MatchWord},
+		{Term: "fornax", Match: MatchSubstring},
+		{Term: "bad idea", Match: MatchWord},
+		{Term: `bla+h`, Match: MatchRegex},
+	})
+	if err != nil {
+		t.Errorf("couldn't build filter: %v", err)
+		return
+	}
+
+	cases := map[string]string{
+		"This is a kerfuffle opinion": "This is a **** opinion",
+		"What a Kerfuffle!": "What a ****!",
+		"I love sharbert.": "I love ****.",
+		"sh@rb3rt is great": "**** is great",
+		"ѕharbert in cyrillic": "**** in cyrillic",
+		"kérfuffle with an accent": "**** with an accent",
+		"kerfuffles are fine": "kerfuffles are fine",
+		"Fornaxes everywhere": "**** everywhere",
+		"that's a BAD   idea, sure": "that's a ****, sure",
+		"blaaaah blah": "**** ****",
+		"nothing to see here": "nothing to see here",
+		"🐦 kerfuffle 🐦": "🐦 **** 🐦",
+	}
+	for in, want := range cases {
+		if got := filter.Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFilterRegexSeesDigits(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Term: `c0vid`, Match: MatchRegex},
+		{Term: `\d{3}-\d{4}`, Match: MatchRegex},
+	})
+	if err != nil {
+		t.Errorf("couldn't build filter: %v", err)
+		return
+	}
+
+	cases := map[string]string{
+		"C0VID hoax": "**** hoax",
+		"covid is real": "covid is real",
+		"call 555-1234 now": "call **** now",
+	}
+	for in, want := range cases {
+		if got := filter.Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Term: "kerfuffle", Match: MatchWord},
+		{Term: "fornax", Match: MatchWord},
+	})
+	if err != nil {
+		t.Errorf("couldn't build filter: %v", err)
+		return
+	}
+
+	matches := filter.Matches("kerfuffle, kerfuffle")
+	if len(matches) != 1 || matches[0].Term != "kerfuffle" {
+		t.Errorf("expected a single kerfuffle match, got %v", matches)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	bad := []Rule{
+		{Term: "", Match: MatchWord},
+		{Term: "!!!", Match: MatchSubstring},
+		{Term: "(unclosed", Match: MatchRegex},
+		{Term: "fine", Match: "fuzzy"},
+	}
+	for _, r := range bad {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", r)
+		}
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	loads := 0
+	terms := []Rule{{Term: "kerfuffle", Match: MatchWord}}
+	cache := NewCache(func(context.Context) ([]Rule, error) {
+		loads++
+		return terms, nil
+	})
+
+	for range 3 {
+		if _, err := cache.Filter(context.Background()); err != nil {
+			t.Errorf("couldn't load filter: %v", err)
+			return
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected rules to be loaded once, got %d", loads)
+	}
+
+	terms = append(terms, Rule{Term: "fornax", Match: MatchWord})
+	cache.Invalidate()
+	filter, err := cache.Filter(context.Background())
+	if err != nil {
+		t.Errorf("couldn't reload filter: %v", err)
+		return
+	}
+	if got := filter.Clean("fornax"); got != "****" {
+		t.Errorf("new term wasn't picked up after invalidation: %q", got)
+	}
+}
@@ -0,0 +1,162 @@
+package moderation
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// leet maps the usual number and symbol substitutions back to letters.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+}
+
+// confusables maps look-alike letters from other scripts to the Latin letter
+// they are usually mistaken for. It only needs to cover lowercase forms since
+// folding lowercases first.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a',
+	'в': 'b',
+	'е': 'e',
+	'к': 'k',
+	'м': 'm',
+	'н': 'h',
+	'о': 'o',
+	'р': 'p',
+	'с': 'c',
+	'т': 't',
+	'у': 'y',
+	'х': 'x',
+	'і': 'i',
+	'ј': 'j',
+	'ѕ': 's',
+	'ԁ': 'd',
+	// Greek
+	'α': 'a',
+	'β': 'b',
+	'ε': 'e',
+	'η': 'n',
+	'ι': 'i',
+	'κ': 'k',
+	'ν': 'v',
+	'ο': 'o',
+	'ρ': 'p',
+	'τ': 't',
+	'υ': 'u',
+	'χ': 'x',
+}
+
+// folded is a case-folded, de-obfuscated copy of a text that remembers where
+// each of its runes came from in the original, so matches found in the
+// folded text can be masked in the original one.
+type folded struct {
+	runes []rune
+	// start and end are byte offsets into the original text.
+	start []int
+	end []int
+}
+
+func fold(s string) folded {
+	return foldWith(s, foldRune)
+}
+
+// lower folds case and accents like fold but keeps digits and symbols as
+// they are. Regex rules run over it, so an admin's "c0vid" or "\d{3}" means
+// what it says. Both map one rune to one rune, so spans in one line up with
+// spans in the other.
+func lower(s string) folded {
+	return foldWith(s, unicode.ToLower)
+}
+
+func foldWith(s string, mapRune func(rune) rune) folded {
+	f := folded{}
+	for i, r := range s {
+		_, size := utf8.DecodeRuneInString(s[i:])
+
+		// NFKD splits "é" into "e" + accent and "ﬁ" into "fi"; the accents
+		// are dropped so "kérfuffle" folds like "kerfuffle".
+		for _, d := range norm.NFKD.String(string(r)) {
+			if unicode.Is(unicode.Mn, d) {
+				continue
+			}
+			f.runes = append(f.runes, mapRune(d))
+			f.start = append(f.start, i)
+			f.end = append(f.end, i + size)
+		}
+
+		// A lone combining mark produces no folded rune; stretch the
+		// previous one so masking it also covers the mark.
+		if n := len(f.end); n > 0 && f.end[n-1] < i + size && f.start[n-1] < i {
+			f.end[n-1] = i + size
+		}
+	}
+	return f
+}
+
+func foldRune(r rune) rune {
+	r = unicode.ToLower(r)
+	if l, ok := leet[r]; ok {
+		return l
+	}
+	if c, ok := confusables[r]; ok {
+		return c
+	}
+	return r
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// span is a half open range of folded rune indices.
+type span struct {
+	from int
+	to int
+}
+
+// tokens splits the folded text into words; anything that isn't a letter or
+// digit after folding (spaces, punctuation, emoji) separates them.
+func (f folded) tokens() []span {
+	var out []span
+	from := -1
+	for i, r := range f.runes {
+		if isWordRune(r) {
+			if from < 0 {
+				from = i
+			}
+			continue
+		}
+		if from >= 0 {
+			out = append(out, span{from, i})
+			from = -1
+		}
+	}
+	if from >= 0 {
+		out = append(out, span{from, len(f.runes)})
+	}
+	return out
+}
+
+func (f folded) text(s span) string {
+	return string(f.runes[s.from:s.to])
+}
+
+// foldTerm folds a banned term into the words it is made of.
+func foldTerm(term string) []string {
+	f := fold(term)
+	var words []string
+	for _, t := range f.tokens() {
+		words = append(words, f.text(t))
+	}
+	return words
+}
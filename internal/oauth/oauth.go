@@ -0,0 +1,166 @@
+// Package oauth holds the protocol rules of Chirpy's OAuth 2.0 authorization
+// server: PKCE, which redirect URIs clients may use, scopes and the error
+// responses of RFC 6749.
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+// Error codes of RFC 6749 sections 4.1.2.1 and 5.2, and RFC 7009.
+const (
+	ErrInvalidRequest = "invalid_request"
+	ErrInvalidClient = "invalid_client"
+	ErrInvalidGrant = "invalid_grant"
+	ErrUnauthorizedClient = "unauthorized_client"
+	ErrUnsupportedGrantType = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrInvalidScope = "invalid_scope"
+	ErrAccessDenied = "access_denied"
+	ErrUnsupportedTokenType = "unsupported_token_type"
+)
+
+// Error is an OAuth error response.
+type Error struct {
+	Code string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// Only S256 is supported: plain would give the code away to whoever can see
+// the authorization request.
+const ChallengeMethodS256 = "S256"
+
+// RFC 7636 section 4.1: 43 to 128 unreserved characters.
+var verifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// ValidChallenge reports whether challenge can be an S256 code challenge,
+// the unpadded base64url encoding of a SHA-256 digest.
+func ValidChallenge(challenge string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// VerifyPKCE checks the code verifier sent to the token endpoint against the
+// challenge from the authorization request.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !verifierPattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ValidateRedirectURI checks a redirect URI a client wants to register. Web
+// apps need https; native apps may use a loopback address over http or a
+// private-use scheme like com.example.app:/callback (RFC 8252).
+func ValidateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("Redirect URI must be an absolute URI")
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("Redirect URI can't have a fragment")
+	}
+	switch {
+	case u.Scheme == "https":
+		if u.Host == "" {
+			return fmt.Errorf("Redirect URI must have a host")
+		}
+	case u.Scheme == "http":
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("Only loopback redirect URIs may use http")
+		}
+	case strings.Contains(u.Scheme, "."):
+	default:
+		return fmt.Errorf("Redirect URI must use https, a loopback address or a reverse domain scheme")
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// MatchRedirectURI reports whether uri is one of the registered ones. URIs
+// are compared as strings, except that loopback URIs may use any port: native
+// apps can't know beforehand which one they get (RFC 8252 section 7.3).
+func MatchRedirectURI(registered []string, uri string) bool {
+	if slices.Contains(registered, uri) {
+		return true
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "http" || !isLoopback(u.Hostname()) {
+		return false
+	}
+	for _, candidate := range registered {
+		c, err := url.Parse(candidate)
+		if err != nil || c.Scheme != "http" || c.Hostname() != u.Hostname() {
+			continue
+		}
+		if c.Path == u.Path && c.RawQuery == u.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectWith adds params to the query of a redirect URI, keeping the
+// query it was registered with.
+func RedirectWith(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// NarrowScope parses a space separated scope request and checks it stays
+// within allowed. An empty request gets all of allowed.
+func NarrowScope(requested string, allowed []string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return allowed, nil
+	}
+	scopes, err := auth.ParseScopes(strings.Fields(requested))
+	if err != nil {
+		return nil, Errorf(ErrInvalidScope, "%v", err)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, Errorf(ErrInvalidScope, "Scope %s wasn't granted to this client", scope)
+		}
+	}
+	return scopes, nil
+}
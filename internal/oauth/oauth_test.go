@@ -0,0 +1,109 @@
+package oauth
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPKCE(t *testing.T) {
+	// RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !ValidChallenge(challenge) {
+		t.Errorf("%s should be a valid challenge", challenge)
+		return
+	}
+	if ValidChallenge(verifier[:20]) {
+		t.Errorf("%s shouldn't be a valid challenge", verifier[:20])
+		return
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Errorf("verifier doesn't match its challenge")
+		return
+	}
+	if VerifyPKCE(verifier[:len(verifier) - 1] + "l", challenge) {
+		t.Errorf("another verifier shouldn't match")
+		return
+	}
+	if VerifyPKCE("short", challenge) {
+		t.Errorf("a verifier under 43 characters shouldn't be accepted")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	cases := map[string]bool{
+		"https://app.example.com/callback": true,
+		"https://app.example.com/callback?tenant=1": true,
+		"http://127.0.0.1/callback": true,
+		"http://[::1]:8080/callback": true,
+		"http://localhost:3000/callback": true,
+		"com.example.app:/callback": true,
+		"http://app.example.com/callback": false,
+		"https://app.example.com/callback#token": false,
+		"/callback": false,
+		"javascript:alert(1)": false,
+		"https:///callback": false,
+	}
+	for uri, valid := range cases {
+		err := ValidateRedirectURI(uri)
+		if valid && err != nil {
+			t.Errorf("%s should be valid: %v", uri, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%s shouldn't be valid", uri)
+		}
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{"https://app.example.com/callback", "http://127.0.0.1/callback"}
+	cases := map[string]bool{
+		"https://app.example.com/callback": true,
+		"https://app.example.com/callback/": false,
+		"https://app.example.com:8443/callback": false,
+		"http://127.0.0.1:51004/callback": true,
+		"http://127.0.0.1:51004/other": false,
+		"http://localhost:51004/callback": false,
+	}
+	for uri, match := range cases {
+		if got := MatchRedirectURI(registered, uri); got != match {
+			t.Errorf("MatchRedirectURI(%s) = %v, expected %v", uri, got, match)
+		}
+	}
+}
+
+func TestRedirectWith(t *testing.T) {
+	got := RedirectWith("https://app.example.com/callback?tenant=1", url.Values{"code": {"abc"}, "state": {"x y"}})
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Errorf("couldn't parse %s: %v", got, err)
+		return
+	}
+	query := u.Query()
+	if query.Get("tenant") != "1" || query.Get("code") != "abc" || query.Get("state") != "x y" {
+		t.Errorf("unexpected redirect: %s", got)
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	allowed := []string{"chirps:read", "chirps:write"}
+
+	scopes, err := NarrowScope("", allowed)
+	if err != nil || len(scopes) != 2 {
+		t.Errorf("an empty request should get every allowed scope, got %v (%v)", scopes, err)
+		return
+	}
+	scopes, err = NarrowScope("chirps:read", allowed)
+	if err != nil || len(scopes) != 1 || scopes[0] != "chirps:read" {
+		t.Errorf("unexpected scopes %v (%v)", scopes, err)
+		return
+	}
+	if _, err := NarrowScope("chirps:read profile:write", allowed); err == nil {
+		t.Errorf("should've refused a scope the client wasn't granted")
+		return
+	}
+	if _, err := NarrowScope("chirps:everything", allowed); err == nil {
+		t.Errorf("should've refused an unknown scope")
+	}
+}
@@ -0,0 +1,292 @@
+// Package oidc signs users in with an external OpenID Connect provider. It
+// discovers the provider, runs the authorization code flow with PKCE and
+// verifies ID tokens against the keys the provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Config struct {
+	// Issuer is the provider's issuer URL, discovery starts from it.
+	Issuer string
+	ClientID string
+	ClientSecret string
+	// RedirectURI is where the provider sends the user back to, the page of
+	// the frontend that finishes the login.
+	RedirectURI string
+}
+
+// Metadata is the part of the discovery document the login needs.
+type Metadata struct {
+	Issuer string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// leeway is the clock skew tolerated when checking ID tokens.
+const leeway = time.Minute
+
+// keysRefreshInterval limits how often an unknown kid makes the provider's
+// keys be fetched again, so forged tokens can't hammer it.
+const keysRefreshInterval = time.Minute
+
+type Provider struct {
+	cfg Config
+	client *http.Client
+	metadata Metadata
+
+	mu sync.Mutex
+	keys map[string]any
+	keysFetchedAt time.Time
+}
+
+// Discover fetches the provider's discovery document and checks it is
+// about the configured issuer.
+func Discover(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	p := &Provider{cfg: cfg, client: client, keys: map[string]any{}}
+
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.metadata); err != nil {
+		return nil, fmt.Errorf("Couldn't discover %s: %w", cfg.Issuer, err)
+	}
+	if p.metadata.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("Discovery document is for issuer %q, not %q", p.metadata.Issuer, cfg.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("Discovery document of %s is missing endpoints", cfg.Issuer)
+	}
+	return p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// Login is what a login needs to remember between sending the user to the
+// provider and getting them back: State and Nonce tie the answer to this
+// login, CodeVerifier is the PKCE secret.
+type Login struct {
+	State string
+	Nonce string
+	CodeVerifier string
+}
+
+func NewLogin() (Login, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Login{}, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return Login{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// AuthCodeURL is where the user is sent to sign in with the provider.
+func (p *Provider) AuthCodeURL(login Login) string {
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id": {p.cfg.ClientID},
+		"redirect_uri": {p.cfg.RedirectURI},
+		"scope": {"openid email profile"},
+		"state": {login.State},
+		"nonce": {login.Nonce},
+		"code_challenge": {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange trades the code the provider sent the user back with for an ID
+// token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type": {"authorization_code"},
+		"code": {code},
+		"redirect_uri": {p.cfg.RedirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1 << 20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("Unreadable token response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Provider refused the code: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("Provider sent no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// Identity is who the provider says signed in.
+type Identity struct {
+	Issuer string
+	Subject string
+	Email string
+	EmailVerified bool
+	Name string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email string `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name string `json:"name"`
+}
+
+// flexibleBool reads booleans some providers send as strings.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// VerifyIDToken checks an ID token as OpenID Connect Core section 3.1.3.7
+// asks: signed by one of the provider's keys, issued by it for this client,
+// current, and answering the login with nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (Identity, error) {
+	claims := idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, &claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithLeeway(leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return Identity{}, fmt.Errorf("ID token was issued to %q", claims.AuthorizedParty)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("ID token doesn't answer this login")
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("ID token has no subject")
+	}
+
+	return Identity{
+		Issuer: claims.Issuer,
+		Subject: claims.Subject,
+		Email: claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name: claims.Name,
+	}, nil
+}
+
+// key returns the provider's key with id kid, fetching the key set again if
+// it is unknown: providers rotate their keys.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("Unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("Couldn't fetch the provider's keys: %w", err)
+	}
+	p.keysFetchedAt = time.Now()
+	p.keys = map[string]any{}
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			// Keys of types we don't use can't sign tokens we accept.
+			continue
+		}
+		p.keys[id] = key
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1 << 20)).Decode(out)
+}
@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/oidc/oidctest"
+)
+
+// startMock runs a mock provider; the caller closes the server.
+func startMock(t *testing.T) (*httptest.Server, *oidctest.Provider, *Provider) {
+	server := httptest.NewUnstartedServer(nil)
+	issuer := "http://" + server.Listener.Addr().String()
+	mock, err := oidctest.New(issuer, "chirpy", "s3cret")
+	if err != nil {
+		t.Errorf("couldn't make mock provider: %v", err)
+		return nil, nil, nil
+	}
+	server.Config.Handler = mock
+	server.Start()
+
+	provider, err := Discover(context.Background(), Config{
+		Issuer: issuer,
+		ClientID: "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURI: "https://chirpy.example/login/callback",
+	}, server.Client())
+	if err != nil {
+		t.Errorf("couldn't discover mock provider: %v", err)
+		server.Close()
+		return nil, nil, nil
+	}
+	return server, mock, provider
+}
+
+// authorize follows the provider's authorization endpoint like a browser
+// would and returns the code it sends back.
+func authorize(t *testing.T, provider *Provider, login Login, hint string) (string, string) {
+	authURL := provider.AuthCodeURL(login)
+	if hint != "" {
+		authURL += "&login_hint=" + url.QueryEscape(hint)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Errorf("couldn't authorize: %v", err)
+		return "", ""
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Errorf("expected a redirect, got %s", resp.Status)
+		return "", ""
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestLogin(t *testing.T) {
+	server, _, provider := startMock(t)
+	if server == nil {
+		return
+	}
+	defer server.Close()
+	login, err := NewLogin()
+	if err != nil {
+		t.Errorf("couldn't start login: %v", err)
+		return
+	}
+
+	code, state := authorize(t, provider, login, "")
+	if state != login.State {
+		t.Errorf("state lost in translation: %q != %q", state, login.State)
+		return
+	}
+	idToken, err := provider.Exchange(context.Background(), code, login.CodeVerifier)
+	if err != nil {
+		t.Errorf("couldn't exchange code: %v", err)
+		return
+	}
+	identity, err := provider.VerifyIDToken(context.Background(), idToken, login.Nonce)
+	if err != nil {
+		t.Errorf("couldn't verify ID token: %v", err)
+		return
+	}
+	if identity.Subject != "1" || identity.Email != "walt@breakingbad.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity: %+v", identity)
+		return
+	}
+
+	if _, err := provider.Exchange(context.Background(), code, login.CodeVerifier); err == nil {
+		t.Errorf("a code should only work once")
+		return
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), idToken, "another nonce"); err == nil {
+		t.Errorf("should've refused an ID token for another login")
+	}
+}
+
+func TestExchangeNeedsVerifier(t *testing.T) {
+	server, _, provider := startMock(t)
+	if server == nil {
+		return
+	}
+	defer server.Close()
+	login, err := NewLogin()
+	if err != nil {
+		t.Errorf("couldn't start login: %v", err)
+		return
+	}
+	code, _ := authorize(t, provider, login, "jesse@breakingbad.com")
+	if _, err := provider.Exchange(context.Background(), code, "not the verifier"); err == nil {
+		t.Errorf("should've failed without the PKCE verifier")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	server, mock, provider := startMock(t)
+	if server == nil {
+		return
+	}
+	defer server.Close()
+	user := oidctest.User{Subject: "2", Email: "jesse@breakingbad.com"}
+
+	idToken, err := mock.IDToken(user, "nonce")
+	if err != nil {
+		t.Errorf("couldn't sign ID token: %v", err)
+		return
+	}
+	identity, err := provider.VerifyIDToken(context.Background(), idToken, "nonce")
+	if err != nil || identity.EmailVerified {
+		t.Errorf("expected an unverified email, got %+v (%v)", identity, err)
+		return
+	}
+
+	other, err := oidctest.New(mock.Issuer, "chirpy", "s3cret")
+	if err != nil {
+		t.Errorf("couldn't make mock provider: %v", err)
+		return
+	}
+	forged, err := other.IDToken(user, "nonce")
+	if err != nil {
+		t.Errorf("couldn't sign ID token: %v", err)
+		return
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), forged, "nonce"); err == nil {
+		t.Errorf("should've refused a token signed with another key")
+		return
+	}
+
+	mock.ClientID = "someone-else"
+	misdirected, err := mock.IDToken(user, "nonce")
+	if err != nil {
+		t.Errorf("couldn't sign ID token: %v", err)
+		return
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), misdirected, "nonce"); err == nil {
+		t.Errorf("should've refused a token for another client")
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	server := httptest.NewUnstartedServer(nil)
+	mock, err := oidctest.New("https://impostor.example", "chirpy", "s3cret")
+	if err != nil {
+		t.Errorf("couldn't make mock provider: %v", err)
+		return
+	}
+	server.Config.Handler = mock
+	server.Start()
+	defer server.Close()
+
+	_, err = Discover(context.Background(), Config{Issuer: server.URL, ClientID: "chirpy"}, server.Client())
+	if err == nil {
+		t.Errorf("should've refused a discovery document for another issuer")
+	}
+}
@@ -0,0 +1,174 @@
+// Package passkey runs the WebAuthn registration and login ceremonies. It
+// keeps no state: the session of a ceremony is handed back to the caller to
+// store between its begin and finish steps.
+package passkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// Credential is a registered passkey. It is stored as JSON.
+type Credential = webauthn.Credential
+
+type Config struct {
+	// RPID is the relying party ID, the domain passkeys are bound to.
+	RPID string
+	RPDisplayName string
+	// Origins are the origins the browser may report, e.g.
+	// "https://chirpy.example".
+	Origins []string
+}
+
+type Service struct {
+	wa *webauthn.WebAuthn
+}
+
+func New(cfg Config) (*Service, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID: cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins: cfg.Origins,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Service{wa: wa}, nil
+}
+
+// User is an account as WebAuthn sees it. Its user handle is the user ID.
+type User struct {
+	ID uuid.UUID
+	Name string
+	Credentials []Credential
+}
+
+func (u User) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u User) WebAuthnName() string {
+	return u.Name
+}
+
+func (u User) WebAuthnDisplayName() string {
+	return u.Name
+}
+
+func (u User) WebAuthnCredentials() []Credential {
+	return u.Credentials
+}
+
+// Challenge starts a ceremony. Options go to the browser for
+// navigator.credentials.create() or .get(); Session stays on the server until
+// the ceremony is finished.
+type Challenge struct {
+	Options any
+	Session json.RawMessage
+}
+
+// BeginRegistration asks the authenticator for a new discoverable credential,
+// excluding the ones the user already has.
+func (s *Service) BeginRegistration(user User) (Challenge, error) {
+	creation, session, err := s.wa.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return challenge(creation, session)
+}
+
+// FinishRegistration checks the authenticator's response and returns the new
+// credential.
+func (s *Service) FinishRegistration(user User, session json.RawMessage, response []byte) (Credential, error) {
+	data, err := sessionData(session)
+	if err != nil {
+		return Credential{}, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return Credential{}, err
+	}
+	credential, err := s.wa.CreateCredential(user, data, parsed)
+	if err != nil {
+		return Credential{}, err
+	}
+	return *credential, nil
+}
+
+// BeginLogin starts a login without knowing the user: the browser offers the
+// passkeys it has for the relying party.
+func (s *Service) BeginLogin() (Challenge, error) {
+	assertion, session, err := s.wa.BeginDiscoverableLogin()
+	if err != nil {
+		return Challenge{}, err
+	}
+	return challenge(assertion, session)
+}
+
+// LookupFunc loads the user a passkey login claims to be for.
+type LookupFunc func(userID uuid.UUID) (User, error)
+
+var ErrCloned = errors.New("the authenticator's signature counter went backwards, it may have been cloned")
+
+// FinishLogin checks the assertion and returns the user it authenticates
+// together with the credential, updated with the new signature counter.
+func (s *Service) FinishLogin(lookup LookupFunc, session json.RawMessage, response []byte) (User, Credential, error) {
+	data, err := sessionData(session)
+	if err != nil {
+		return User{}, Credential{}, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return User{}, Credential{}, err
+	}
+
+	var found User
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		found, err = lookup(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range found.Credentials {
+			if bytes.Equal(c.ID, rawID) {
+				return found, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown credential")
+	}
+
+	_, credential, err := s.wa.ValidatePasskeyLogin(handler, data, parsed)
+	if err != nil {
+		return User{}, Credential{}, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return User{}, Credential{}, ErrCloned
+	}
+	return found, *credential, nil
+}
+
+func challenge(options any, session *webauthn.SessionData) (Challenge, error) {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return Challenge{Options: options, Session: raw}, nil
+}
+
+func sessionData(raw json.RawMessage) (webauthn.SessionData, error) {
+	data := webauthn.SessionData{}
+	err := json.Unmarshal(raw, &data)
+	return data, err
+}
@@ -0,0 +1,313 @@
+package passkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID = "localhost"
+	testOrigin = "http://localhost:8080"
+)
+
+var b64 = base64.RawURLEncoding
+
+// authenticator is a software passkey: an ES256 key pair that answers
+// registration and login challenges the way a browser and platform
+// authenticator would, with "none" attestation.
+type authenticator struct {
+	key *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle []byte
+	signCount uint32
+}
+
+func newAuthenticator() (*authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	return &authenticator{key: key, credentialID: credentialID}, nil
+}
+
+// challengeOf digs the challenge out of the options sent to the browser.
+func challengeOf(options any) (string, error) {
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return "", err
+	}
+	return parsed.PublicKey.Challenge, nil
+}
+
+func clientData(kind, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type": kind,
+		"challenge": challenge,
+		"origin": origin,
+	})
+	return data
+}
+
+func (a *authenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	out := append([]byte{}, rpHash[:]...)
+	out = append(out, flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	return append(out, attested...)
+}
+
+func (a *authenticator) register(options any, userID uuid.UUID, origin string) ([]byte, error) {
+	challenge, err := challengeOf(options)
+	if err != nil {
+		return nil, err
+	}
+	a.userHandle = userID[:]
+
+	coseKey, err := cbor.Marshal(map[int]any{
+		1: 2, // kty: EC2
+		3: -7, // alg: ES256
+		-1: 1, // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	// User present, user verified, attested credential data included.
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt": "none",
+		"attStmt": map[string]any{},
+		"authData": a.authData(0x45, attested),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id": b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type": "public-key",
+		"response": map[string]string{
+			"clientDataJSON": b64.EncodeToString(clientData("webauthn.create", challenge, origin)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+}
+
+func (a *authenticator) login(options any, origin string) ([]byte, error) {
+	challenge, err := challengeOf(options)
+	if err != nil {
+		return nil, err
+	}
+	a.signCount++
+
+	data := clientData("webauthn.get", challenge, origin)
+	authData := a.authData(0x05, nil)
+	dataHash := sha256.Sum256(data)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), dataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id": b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type": "public-key",
+		"response": map[string]string{
+			"clientDataJSON": b64.EncodeToString(data),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature": b64.EncodeToString(signature),
+			"userHandle": b64.EncodeToString(a.userHandle),
+		},
+	})
+}
+
+func newTestService() (*Service, error) {
+	return New(Config{
+		RPID: testRPID,
+		RPDisplayName: "Chirpy",
+		Origins: []string{testOrigin},
+	})
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	service, err := newTestService()
+	if err != nil {
+		t.Errorf("couldn't create service: %v", err)
+		return
+	}
+	device, err := newAuthenticator()
+	if err != nil {
+		t.Errorf("couldn't create authenticator: %v", err)
+		return
+	}
+	user := User{ID: uuid.New(), Name: "walt@breakingbad.com"}
+
+	reg, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Errorf("couldn't begin registration: %v", err)
+		return
+	}
+	response, err := device.register(reg.Options, user.ID, testOrigin)
+	if err != nil {
+		t.Errorf("authenticator couldn't register: %v", err)
+		return
+	}
+	credential, err := service.FinishRegistration(user, reg.Session, response)
+	if err != nil {
+		t.Errorf("couldn't finish registration: %v", err)
+		return
+	}
+	user.Credentials = []Credential{credential}
+
+	lookup := func(userID uuid.UUID) (User, error) {
+		if userID != user.ID {
+			return User{}, fmt.Errorf("no such user")
+		}
+		return user, nil
+	}
+
+	login, err := service.BeginLogin()
+	if err != nil {
+		t.Errorf("couldn't begin login: %v", err)
+		return
+	}
+	response, err = device.login(login.Options, testOrigin)
+	if err != nil {
+		t.Errorf("authenticator couldn't log in: %v", err)
+		return
+	}
+	found, updated, err := service.FinishLogin(lookup, login.Session, response)
+	if err != nil {
+		t.Errorf("couldn't finish login: %v", err)
+		return
+	}
+	if found.ID != user.ID {
+		t.Errorf("logged in as the wrong user: %v", found.ID)
+		return
+	}
+	if updated.Authenticator.SignCount != 1 {
+		t.Errorf("sign count should have been updated, got %d", updated.Authenticator.SignCount)
+		return
+	}
+
+	// Once the new counter is stored, the same assertion again is a replay.
+	user.Credentials = []Credential{updated}
+	if _, _, err := service.FinishLogin(lookup, login.Session, response); !errors.Is(err, ErrCloned) {
+		t.Errorf("a replayed assertion should be refused once the counter moved, got %v", err)
+	}
+}
+
+func TestPasskeyRejects(t *testing.T) {
+	service, err := newTestService()
+	if err != nil {
+		t.Errorf("couldn't create service: %v", err)
+		return
+	}
+	device, err := newAuthenticator()
+	if err != nil {
+		t.Errorf("couldn't create authenticator: %v", err)
+		return
+	}
+	user := User{ID: uuid.New(), Name: "walt@breakingbad.com"}
+
+	reg, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Errorf("couldn't begin registration: %v", err)
+		return
+	}
+	phished, err := device.register(reg.Options, user.ID, "https://chirpy.evil")
+	if err != nil {
+		t.Errorf("authenticator couldn't register: %v", err)
+		return
+	}
+	if _, err := service.FinishRegistration(user, reg.Session, phished); err == nil {
+		t.Errorf("registration from another origin should be refused")
+		return
+	}
+
+	response, err := device.register(reg.Options, user.ID, testOrigin)
+	if err != nil {
+		t.Errorf("authenticator couldn't register: %v", err)
+		return
+	}
+	credential, err := service.FinishRegistration(user, reg.Session, response)
+	if err != nil {
+		t.Errorf("couldn't finish registration: %v", err)
+		return
+	}
+	user.Credentials = []Credential{credential}
+	lookup := func(uuid.UUID) (User, error) {
+		return user, nil
+	}
+
+	login, err := service.BeginLogin()
+	if err != nil {
+		t.Errorf("couldn't begin login: %v", err)
+		return
+	}
+
+	// A different key claiming the same credential ID.
+	impostor, err := newAuthenticator()
+	if err != nil {
+		t.Errorf("couldn't create authenticator: %v", err)
+		return
+	}
+	impostor.credentialID = device.credentialID
+	impostor.userHandle = device.userHandle
+	forged, err := impostor.login(login.Options, testOrigin)
+	if err != nil {
+		t.Errorf("authenticator couldn't log in: %v", err)
+		return
+	}
+	if _, _, err := service.FinishLogin(lookup, login.Session, forged); err == nil {
+		t.Errorf("an assertion signed with the wrong key should be refused")
+		return
+	}
+
+	other, err := service.BeginLogin()
+	if err != nil {
+		t.Errorf("couldn't begin login: %v", err)
+		return
+	}
+	response, err = device.login(other.Options, testOrigin)
+	if err != nil {
+		t.Errorf("authenticator couldn't log in: %v", err)
+		return
+	}
+	if _, _, err := service.FinishLogin(lookup, login.Session, response); err == nil {
+		t.Errorf("an assertion for another challenge should be refused")
+	}
+}
@@ -0,0 +1,77 @@
+// Package throttle decides how long logins are refused after failed
+// attempts. Counting the failures is left to the caller.
+package throttle
+
+import (
+	"time"
+)
+
+type Policy struct {
+	// FreeAttempts failures in a row are allowed without any delay.
+	FreeAttempts int
+	// After that, each failure blocks for BaseDelay, doubling with every
+	// further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay time.Duration
+	// LockoutAfter failures lock the subject out for LockoutDuration.
+	LockoutAfter int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered: a failure more than
+	// Window after the previous one starts counting from one again.
+	Window time.Duration
+}
+
+// DefaultAccountPolicy throttles failures against one account.
+func DefaultAccountPolicy() Policy {
+	return Policy{
+		FreeAttempts: 3,
+		BaseDelay: time.Second,
+		MaxDelay: time.Minute,
+		LockoutAfter: 10,
+		LockoutDuration: 15 * time.Minute,
+		Window: time.Hour,
+	}
+}
+
+// DefaultIPPolicy throttles failures from one address. It is looser than the
+// account policy because many users can share an address behind a NAT.
+func DefaultIPPolicy() Policy {
+	return Policy{
+		FreeAttempts: 10,
+		BaseDelay: time.Second,
+		MaxDelay: time.Minute,
+		LockoutAfter: 50,
+		LockoutDuration: 15 * time.Minute,
+		Window: time.Hour,
+	}
+}
+
+// BlockedFor is how long to refuse attempts after the failures-th failure
+// in a row.
+func (p Policy) BlockedFor(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for range failures - p.FreeAttempts - 1 {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// RetryAfter is the value of a Retry-After header for a block ending at
+// until: whole seconds, rounded up so retrying then is never too early.
+func RetryAfter(until, now time.Time) int {
+	wait := until.Sub(now)
+	seconds := int(wait / time.Second)
+	if wait % time.Second != 0 {
+		seconds++
+	}
+	return max(seconds, 1)
+}
@@ -0,0 +1,54 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockedFor(t *testing.T) {
+	p := Policy{
+		FreeAttempts: 3,
+		BaseDelay: time.Second,
+		MaxDelay: 10 * time.Second,
+		LockoutAfter: 8,
+		LockoutDuration: 15 * time.Minute,
+	}
+	cases := []struct {
+		failures int
+		want time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 15 * time.Minute},
+		{100, 15 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := p.BlockedFor(c.failures); got != c.want {
+			t.Errorf("BlockedFor(%d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+
+	p.LockoutAfter = 0
+	if got := p.BlockedFor(1000); got != p.MaxDelay {
+		t.Errorf("delay should be capped at %v, got %v", p.MaxDelay, got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	cases := map[time.Duration]int{
+		1500 * time.Millisecond: 2,
+		2 * time.Second: 2,
+		time.Millisecond: 1,
+		-time.Second: 1,
+	}
+	for wait, want := range cases {
+		if got := RetryAfter(now.Add(wait), now); got != want {
+			t.Errorf("RetryAfter(%v) = %d, want %d", wait, got, want)
+		}
+	}
+}
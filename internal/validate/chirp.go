@@ -0,0 +1,118 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// CountMode selects how the length of a chirp is measured.
+type CountMode string
+
+const (
+	// CountGraphemes counts extended grapheme clusters, i.e. what a reader
+	// perceives as one character: "é", "🇧🇷" and "👩‍👩‍👧" each count as one.
+	CountGraphemes CountMode = "graphemes"
+	// CountCodePoints counts Unicode code points after normalisation.
+	CountCodePoints CountMode = "codepoints"
+)
+
+func ParseCountMode(s string) (CountMode, error) {
+	switch CountMode(s) {
+	case "", CountGraphemes:
+		return CountGraphemes, nil
+	case CountCodePoints:
+		return CountCodePoints, nil
+	}
+	return "", fmt.Errorf("unknown chirp length mode %q", s)
+}
+
+// ChirpPolicy is the documented policy for chirp bodies:
+//
+//   - the body is normalised to NFC before anything else, so a precomposed
+//     "é" and "e" + U+0301 are stored and counted the same way;
+//   - the length is measured with Mode (grapheme clusters by default) and
+//     must not exceed MaxLength, or MaxLengthRed for Chirpy Red members;
+//   - CRLF and lone CR line breaks are stored as LF;
+//   - control characters are rejected, except for line feeds and tabs, and
+//     so are bidirectional formatting characters (U+202E and friends), which
+//     can make a chirp display differently from what it says;
+//   - bodies that are empty or only whitespace are rejected.
+type ChirpPolicy struct {
+	Mode CountMode
+	MaxLength int
+	MaxLengthRed int
+}
+
+func DefaultChirpPolicy() ChirpPolicy {
+	return ChirpPolicy{
+		Mode: CountGraphemes,
+		MaxLength: 140,
+		MaxLengthRed: 280,
+	}
+}
+
+func (p ChirpPolicy) Limit(isChirpyRed bool) int {
+	if isChirpyRed && p.MaxLengthRed > p.MaxLength {
+		return p.MaxLengthRed
+	}
+	return p.MaxLength
+}
+
+func (p ChirpPolicy) Length(body string) int {
+	if p.Mode == CountCodePoints {
+		return utf8.RuneCountInString(body)
+	}
+	return uniseg.GraphemeClusterCount(body)
+}
+
+// Chirp validates body against the policy and returns the normalised body
+// that should be stored.
+func (p ChirpPolicy) Chirp(body string, isChirpyRed bool) (string, error) {
+	var errs Errors
+
+	if !utf8.ValidString(body) {
+		errs.Add("body", "invalid_encoding", "Chirp must be valid UTF-8")
+		return "", errs
+	}
+
+	body = norm.NFC.String(body)
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\r", "\n")
+
+	if strings.TrimSpace(body) == "" {
+		errs.Add("body", "empty", "Chirp cannot be empty")
+		return "", errs
+	}
+
+	for _, r := range body {
+		if r == '\n' || r == '\t' {
+			continue
+		}
+		if unicode.IsControl(r) {
+			errs.Add("body", "control_character",
+				fmt.Sprintf("Chirp contains a control character (U+%04X)", r))
+			break
+		}
+		if unicode.Is(unicode.Bidi_Control, r) {
+			errs.Add("body", "bidi_control",
+				fmt.Sprintf("Chirp contains a bidirectional formatting character (U+%04X)", r))
+			break
+		}
+	}
+
+	limit := p.Limit(isChirpyRed)
+	if n := p.Length(body); n > limit {
+		errs.Add("body", "too_long",
+			fmt.Sprintf("Chirp is too long (%d of %d characters)", n, limit))
+	}
+
+	if err := errs.Err(); err != nil {
+		return "", err
+	}
+	return body, nil
+}
@@ -0,0 +1,96 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChirpLength(t *testing.T) {
+	policy := DefaultChirpPolicy()
+
+	// 140 emoji are far more than 140 bytes but still a valid chirp.
+	body := strings.Repeat("🐦", 140)
+	if _, err := policy.Chirp(body, false); err != nil {
+		t.Errorf("140 emoji should be accepted: %v", err)
+		return
+	}
+
+	if _, err := policy.Chirp(body + "!", false); err == nil {
+		t.Errorf("141 characters should be rejected")
+		return
+	}
+
+	if _, err := policy.Chirp(body + "!", true); err != nil {
+		t.Errorf("Chirpy Red users should get the higher limit: %v", err)
+		return
+	}
+
+	family := "👩‍👩‍👧"
+	if n := policy.Length(family); n != 1 {
+		t.Errorf("a ZWJ sequence should count as one grapheme, got %d", n)
+		return
+	}
+
+	policy.Mode = CountCodePoints
+	if n := policy.Length(family); n != 5 {
+		t.Errorf("a ZWJ sequence should count as five code points, got %d", n)
+		return
+	}
+}
+
+func TestChirpNormalisation(t *testing.T) {
+	policy := DefaultChirpPolicy()
+
+	decomposed := "cafe\u0301"
+	body, err := policy.Chirp(decomposed, false)
+	if err != nil {
+		t.Errorf("couldn't validate chirp: %v", err)
+		return
+	}
+	if body != "caf\u00e9" {
+		t.Errorf("body wasn't normalised to NFC: %q", body)
+		return
+	}
+}
+
+func TestChirpRejects(t *testing.T) {
+	policy := DefaultChirpPolicy()
+
+	cases := map[string]string{
+		"": "empty",
+		" \n\t ": "empty",
+		"hello\x00world": "control_character",
+		"bell\u0007": "control_character",
+		"evil\u202Etxt.exe": "bidi_control",
+		"\u2066isolate\u2069": "bidi_control",
+	}
+	for body, code := range cases {
+		_, err := policy.Chirp(body, false)
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Errorf("%q should have failed with field errors, got %v", body, err)
+			continue
+		}
+		if errs[0].Field != "body" || errs[0].Code != code {
+			t.Errorf("%q: expected body/%s, got %s/%s", body, code, errs[0].Field, errs[0].Code)
+		}
+	}
+
+	if _, err := policy.Chirp("line one\nline two", false); err != nil {
+		t.Errorf("line breaks should be allowed: %v", err)
+	}
+
+	body, err := policy.Chirp("line one\r\nline two\rline three", false)
+	if err != nil {
+		t.Errorf("CRLF line breaks should be allowed: %v", err)
+		return
+	}
+	if body != "line one\nline two\nline three" {
+		t.Errorf("line breaks weren't normalised to LF: %q", body)
+	}
+
+	if _, err := policy.Chirp("👩\u200d👩\u200d👧", false); err != nil {
+		t.Errorf("zero width joiners in emoji should be allowed: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package validate
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// maxEmailLength is the longest address SMTP can carry (RFC 5321).
+const maxEmailLength = 254
+
+// Email checks that address is a bare address such as "walt@example.com",
+// not a display name form like "Walt <walt@example.com>", and returns it
+// without surrounding whitespace. Whether it is deliverable is only known
+// once the verification email arrives.
+func Email(address string) (string, error) {
+	var errs Errors
+
+	address = strings.TrimSpace(address)
+	if address == "" {
+		errs.Add("email", "empty", "Email cannot be empty")
+		return "", errs
+	}
+	if len(address) > maxEmailLength {
+		errs.Add("email", "too_long", "Email is too long")
+		return "", errs
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		errs.Add("email", "invalid", "Email must be a valid address")
+		return "", errs
+	}
+	_, domain, _ := strings.Cut(address, "@")
+	if !strings.Contains(domain, ".") && domain != "localhost" {
+		errs.Add("email", "invalid", "Email must be a valid address")
+		return "", errs
+	}
+	return address, nil
+}
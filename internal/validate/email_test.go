@@ -0,0 +1,32 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	got, err := Email("  walt@breakingbad.com ")
+	if err != nil || got != "walt@breakingbad.com" {
+		t.Errorf("expected a trimmed address, got %q, %v", got, err)
+		return
+	}
+
+	cases := map[string]string{
+		"": "empty",
+		"walt": "invalid",
+		"walt@": "invalid",
+		"walt@breakingbad": "invalid",
+		"Walt <walt@breakingbad.com>": "invalid",
+		"walt@breakingbad.com\r\nBcc: jesse@breakingbad.com": "invalid",
+		strings.Repeat("w", 250) + "@a.com": "too_long",
+	}
+	for address, code := range cases {
+		_, err := Email(address)
+		var errs Errors
+		if !errors.As(err, &errs) || errs[0].Field != "email" || errs[0].Code != code {
+			t.Errorf("%q: expected %s, got %v", address, code, err)
+		}
+	}
+}
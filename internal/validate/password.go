@@ -0,0 +1,158 @@
+package validate
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	Contains(password string) (bool, error)
+}
+
+// PasswordPolicy is the documented policy for passwords:
+//
+//   - between MinLength and MaxLength characters;
+//   - an estimated strength of at least MinEntropy bits, see Entropy;
+//   - not containing the user's email, its local part or the name of its
+//     domain;
+//   - not in the Breached corpus, when one is configured.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	MinEntropy float64
+	Breached BreachChecker
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 128,
+		MinEntropy: 40,
+	}
+}
+
+// Password checks password for the account with the given email. Problems
+// with the password come back as Errors; any other error means the breached
+// password corpus couldn't be read.
+func (p PasswordPolicy) Password(password, email string) error {
+	var errs Errors
+
+	if !utf8.ValidString(password) {
+		errs.Add("password", "invalid_encoding", "Password must be valid UTF-8")
+		return errs
+	}
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		errs.Add("password", "too_short",
+			fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+		return errs
+	}
+	if n > p.MaxLength {
+		errs.Add("password", "too_long",
+			fmt.Sprintf("Password can't be longer than %d characters", p.MaxLength))
+		return errs
+	}
+
+	if containsEmail(password, email) {
+		errs.Add("password", "contains_email", "Password can't contain your email address")
+	}
+	if bits := Entropy(password); bits < p.MinEntropy {
+		errs.Add("password", "too_weak",
+			"Password is too easy to guess, make it longer or mix in other kinds of characters")
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("couldn't check breached passwords: %w", err)
+		}
+		if breached {
+			errs.Add("password", "breached",
+				"Password appears in a known data breach, please choose another one")
+			return errs
+		}
+	}
+	return nil
+}
+
+// Entropy estimates the strength of a password in bits: every character
+// adds log2 of the size of the character classes used, except characters
+// that repeat or continue a sequence ("aaa", "abc", "321"), which add one.
+// It is a rough guide, not a cracking model; the breached password corpus
+// catches the common passwords it overrates.
+func Entropy(password string) float64 {
+	pool := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+	prev := rune(-1)
+	for _, r := range password {
+		lr := unicode.ToLower(r)
+		if prev >= 0 && (lr == prev || lr == prev + 1 || lr == prev - 1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = lr
+	}
+	return bits
+}
+
+// containsEmail reports whether password contains the email, its local part
+// or a label of its domain other than the top level one, ignoring case.
+// Parts shorter than three characters are too common to mean anything.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	local, domain, _ := strings.Cut(email, "@")
+	parts := []string{email, local}
+	labels := strings.Split(domain, ".")
+	if len(labels) > 1 {
+		labels = labels[:len(labels) - 1]
+	}
+	parts = append(parts, labels...)
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
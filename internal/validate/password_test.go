@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeCorpus map[string]bool
+
+func (c fakeCorpus) Contains(password string) (bool, error) {
+	return c[password], nil
+}
+
+type brokenCorpus struct{}
+
+func (brokenCorpus) Contains(string) (bool, error) {
+	return false, errors.New("disk on fire")
+}
+
+func TestPassword(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	policy.Breached = fakeCorpus{"Tr0ub4dor&3xyz": true}
+	email := "walt@breakingbad.com"
+
+	if err := policy.Password("correct horse battery staple", email); err != nil {
+		t.Errorf("a long passphrase should be accepted: %v", err)
+		return
+	}
+
+	cases := map[string]string{
+		"": "too_short",
+		"Ab1!": "too_short",
+		"aaaaaaaaaaaaaaaaaaaa": "too_weak",
+		"abcdefghijklmnop": "too_weak",
+		"12345678": "too_weak",
+		"my name is Walt, really": "contains_email",
+		"BreakingBad-forever-99": "contains_email",
+		"Tr0ub4dor&3xyz": "breached",
+	}
+	for password, code := range cases {
+		err := policy.Password(password, email)
+		var errs Errors
+		if !errors.As(err, &errs) || errs[0].Field != "password" || errs[0].Code != code {
+			t.Errorf("%q: expected %s, got %v", password, code, err)
+		}
+	}
+
+	policy.Breached = brokenCorpus{}
+	err := policy.Password("correct horse battery staple", email)
+	var errs Errors
+	if err == nil || errors.As(err, &errs) {
+		t.Errorf("a corpus failure shouldn't look like a validation error: %v", err)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if Entropy("") != 0 {
+		t.Errorf("an empty password has no entropy")
+	}
+	if Entropy("aaaaaaaa") >= Entropy("aqzmwkxe") {
+		t.Errorf("repeated characters should count for less than varied ones")
+	}
+	if Entropy("Xq7#pL2!") <= Entropy("xqhnplaw") {
+		t.Errorf("mixing character classes should count for more")
+	}
+}
@@ -0,0 +1,42 @@
+package validate
+
+import (
+	"strings"
+)
+
+// FieldError describes a single problem with one field of a request body.
+// Code is a stable machine readable identifier, Message is meant for humans.
+type FieldError struct {
+	Field string `json:"field"`
+	Code string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors collects every FieldError found while validating a request so
+// clients can fix all of them at once instead of one per round trip.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field + ": " + fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{
+		Field: field,
+		Code: code,
+		Message: message,
+	})
+}
+
+// Err returns nil when no errors were collected, so callers can write
+// `if err := errs.Err(); err != nil`.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"net/http"
+)
+
+// getJWKS publishes the public keys access tokens are verified with, so other
+// services can check them without holding any secret.
+func (a *apiConfig) getJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, a.jwtKeys.JWKS())
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/throttle"
+)
+
+const (
+	throttleAccount = "account"
+	throttleIP = "ip"
+)
+
+// throttleSubject is one thing failed logins are counted against.
+type throttleSubject struct {
+	kind string
+	subject string
+	policy throttle.Policy
+}
+
+// loginSubjects are the account, by email whether or not it exists, and the
+// client address a login attempt counts against.
+func (a *apiConfig) loginSubjects(r *http.Request, email string) []throttleSubject {
+	return []throttleSubject{
+		{kind: throttleAccount, subject: strings.ToLower(strings.TrimSpace(email)), policy: a.accountThrottle},
+		{kind: throttleIP, subject: a.clientIP(r), policy: a.ipThrottle},
+	}
+}
+
+// loginAttempt is what reserveLoginAttempt counted for one login attempt.
+type loginAttempt []reservedSubject
+
+type reservedSubject struct {
+	throttleSubject
+	failures int
+	// lockedUntil is the block the counted failure applied, if any.
+	lockedUntil sql.NullTime
+}
+
+var errLoginThrottled = errors.New("login throttled")
+
+// reserveLoginAttempt counts the attempt as a failure against every subject
+// before its credentials are checked, and applies the block that failure
+// earns right away. Concurrent attempts are counted one after the other, so
+// each sees the blocks of the ones before it and none can slip past the
+// limit. An attempt that passes takes its count back with
+// releaseLoginAttempt. While any subject is blocked the attempt is refused
+// with a 429 and Retry-After, and isn't counted. It writes the error
+// response itself.
+func (a *apiConfig) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, subjects []throttleSubject) (loginAttempt, bool) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	var attempt loginAttempt
+	var until time.Time
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		attempt = nil
+		for _, s := range subjects {
+			t, err := q.RecordLoginFailure(r.Context(), database.RecordLoginFailureParams{
+				Kind: s.kind,
+				Subject: s.subject,
+				FailedAt: now,
+				WindowStart: now.Add(-s.policy.Window),
+			})
+			if err != nil {
+				return err
+			}
+			if t.LockedUntil.Valid && t.LockedUntil.Time.After(now) {
+				if t.LockedUntil.Time.After(until) {
+					until = t.LockedUntil.Time
+				}
+				continue
+			}
+
+			reserved := reservedSubject{throttleSubject: s, failures: int(t.Failures)}
+			if blocked := s.policy.BlockedFor(reserved.failures); blocked > 0 {
+				reserved.lockedUntil = sql.NullTime{Time: now.Add(blocked), Valid: true}
+				err = q.LockLoginThrottle(r.Context(), database.LockLoginThrottleParams{
+					Kind: s.kind,
+					Subject: s.subject,
+					LockedUntil: reserved.lockedUntil,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			attempt = append(attempt, reserved)
+		}
+		// Refused attempts don't count: roll the whole reservation back.
+		if !until.IsZero() {
+			return errLoginThrottled
+		}
+		return nil
+	})
+	if errors.Is(err, errLoginThrottled) {
+		w.Header().Set("Retry-After", strconv.Itoa(throttle.RetryAfter(until, now)))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return attempt, true
+}
+
+// failLoginAttempt keeps the failure reserveLoginAttempt counted; it only
+// reports the subjects it locked out.
+func failLoginAttempt(attempt loginAttempt) {
+	for _, s := range attempt {
+		if s.failures == s.policy.LockoutAfter {
+			log.Printf("Locked out %s %s for %v after %d failed logins", s.kind, s.subject, s.policy.LockoutDuration, s.failures)
+		}
+	}
+}
+
+// releaseLoginAttempt takes back what reserveLoginAttempt counted for an
+// attempt that passed, e.g. a correct password still waiting for its second
+// factor.
+func (a *apiConfig) releaseLoginAttempt(ctx context.Context, attempt loginAttempt) error {
+	for _, s := range attempt {
+		err := a.dbQueries.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{
+			Kind: s.kind,
+			Subject: s.subject,
+			ReservedLock: s.lockedUntil,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearLoginFailures takes back the attempt and forgets the failures against
+// the account once a login succeeds. The address keeps its count: one
+// working password mustn't let it go on guessing others. Failures that are
+// no longer remembered are tidied up while at it.
+func (a *apiConfig) clearLoginFailures(ctx context.Context, attempt loginAttempt) error {
+	if err := a.releaseLoginAttempt(ctx, attempt); err != nil {
+		return err
+	}
+	for _, s := range attempt {
+		if s.kind != throttleAccount {
+			continue
+		}
+		_, err := a.dbQueries.ClearLoginThrottle(ctx, database.ClearLoginThrottleParams{
+			Kind: s.kind,
+			Subject: s.subject,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	err := a.dbQueries.DeleteStaleLoginThrottles(ctx, database.DeleteStaleLoginThrottlesParams{
+		LastFailureAt: now.Add(-max(a.accountThrottle.Window, a.ipThrottle.Window)),
+		LockedUntil: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't delete stale login throttles: %v", err)
+	}
+	return nil
+}
+
+func (a *apiConfig) listLockouts(w http.ResponseWriter, r *http.Request, user database.User) {
+	now := time.Now().UTC()
+	throttles, err := a.dbQueries.ListLoginThrottles(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type lockoutResponse struct {
+		Kind string `json:"kind"`
+		Subject string `json:"subject"`
+		Failures int32 `json:"failures"`
+		LastFailureAt time.Time `json:"last_failure_at"`
+		LockedUntil *time.Time `json:"locked_until"`
+		Locked bool `json:"locked"`
+	}
+	lockoutsData := []lockoutResponse{}
+	for _, t := range throttles {
+		lockout := lockoutResponse{
+			Kind: t.Kind,
+			Subject: t.Subject,
+			Failures: t.Failures,
+			LastFailureAt: t.LastFailureAt,
+		}
+		if t.LockedUntil.Valid {
+			lockout.LockedUntil = &t.LockedUntil.Time
+			lockout.Locked = t.LockedUntil.Time.After(now)
+		}
+		lockoutsData = append(lockoutsData, lockout)
+	}
+	respondWithJSON(w, http.StatusOK, lockoutsData)
+}
+
+// clearLockout unlocks an account or address and forgets its failures.
+func (a *apiConfig) clearLockout(w http.ResponseWriter, r *http.Request, user database.User) {
+	kind := r.PathValue("kind")
+	if kind != throttleAccount && kind != throttleIP {
+		respondWithError(w, http.StatusBadRequest, "Kind must be account or ip")
+		return
+	}
+	subject := r.PathValue("subject")
+	if kind == throttleAccount {
+		subject = strings.ToLower(subject)
+	}
+
+	cleared, err := a.dbQueries.ClearLoginThrottle(r.Context(), database.ClearLoginThrottleParams{
+		Kind: kind,
+		Subject: subject,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if cleared == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find failed logins for that " + kind)
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditAdminClearLockout,
+		ActorID: user.ID,
+		Metadata: map[string]any{"kind": kind, "subject": subject},
+	})
+	log.Printf("Cleared failed logins of %s %s", kind, subject)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentLoginAttemptsAreThrottled(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	if _, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user"); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	const attempts = 30
+	codes := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := s.request("POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": "wrong password guess"})
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	// The failure after the free attempts blocks everything running
+	// alongside it.
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status %d", code)
+			return
+		}
+	}
+	if limit := s.api.accountThrottle.FreeAttempts + 1; checked > limit {
+		t.Errorf("%d passwords were checked, expected at most %d", checked, limit)
+	}
+}
+
+func TestLoginClearsAccountFailures(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	admin, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "admin")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	failures := s.api.accountThrottle.FreeAttempts
+	for range failures {
+		s.request("POST", "/api/login", "", map[string]string{"email": "walt@breakingbad.com", "password": "wrong password guess"})
+	}
+	if _, err := s.login("walt@breakingbad.com", "say my name heisenberg"); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	w := s.request("GET", "/admin/lockouts", admin.Token, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	lockouts := []struct {
+		Kind string `json:"kind"`
+		Failures int `json:"failures"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &lockouts); err != nil {
+		t.Errorf("couldn't decode the lockouts: %v", err)
+		return
+	}
+	for _, lockout := range lockouts {
+		if lockout.Kind == throttleAccount {
+			t.Errorf("the account's failures should be forgotten, got %+v", lockout)
+		}
+		if lockout.Kind == throttleIP && lockout.Failures != failures {
+			t.Errorf("expected the address to keep only its failures, got %+v", lockout)
+		}
+	}
+}
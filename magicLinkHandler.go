@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+var errOtherBrowser = errors.New("This link was asked for in another browser, open it there or ask for a new one")
+
+// requestMagicLink emails a link that logs the user in without their
+// password. Like requestPasswordReset it does the work in the background, so
+// it answers the same, and as fast, whether or not the email belongs to an
+// account.
+func (a *apiConfig) requestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type linkInput struct {
+		Email string `json:"email"`
+	}
+	input := linkInput{}
+	decodeInput(w, r, &input)
+
+	// Every browser asking gets the cookie, so its presence says nothing
+	// about the email either.
+	browserHash, err := a.bindBrowser(w, r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a.inBackground(r, "send a login link", func(ctx context.Context) error {
+		user, err := a.dbQueries.GetUserByEmail(ctx, input.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		link, err := auth.MakeMagicLinkToken()
+		if err != nil {
+			return err
+		}
+		// Only the latest link works.
+		err = a.withTx(ctx, func(q *database.Queries) error {
+			if err := q.DeleteMagicLinks(ctx, user.ID); err != nil {
+				return err
+			}
+			return q.CreateMagicLink(ctx, database.CreateMagicLinkParams{
+				ID: link.Selector,
+				TokenHash: link.VerifierHash,
+				UserID: user.ID,
+				BrowserHash: browserHash,
+				ExpiresAt: time.Now().UTC().Add(magicLinkTTL),
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		err = a.mailer.Send(ctx, mailer.Message{
+			To: user.Email,
+			Subject: "Log in to Chirpy",
+			Body: fmt.Sprintf("Open this link in the browser you asked for it from to log in to Chirpy, " +
+				"it works once and expires in %v:\n\n%s\n\n" +
+				"If it wasn't you, ignore this email.\n",
+				magicLinkTTL, a.magicLinkFor(link.Token)),
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Login link requested for user %v", user.ID)
+		return nil
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// magicLinkFor puts token in the query of the frontend page that confirms
+// login links. The page posts it back, so mail scanners fetching the link
+// don't use it up.
+func (a *apiConfig) magicLinkFor(token string) string {
+	link := *a.magicLinkURL
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// confirmMagicLink logs in with the token of a login link, from the browser
+// the link was asked for in.
+func (a *apiConfig) confirmMagicLink(w http.ResponseWriter, r *http.Request) {
+	type confirmInput struct {
+		Token string `json:"token"`
+	}
+	input := confirmInput{}
+	decodeInput(w, r, &input)
+
+	selector, verifier, err := auth.ParseMagicLinkToken(input.Token)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var user database.User
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		link, err := q.GetMagicLinkForUpdate(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if !auth.CheckVerifier(verifier, link.TokenHash) || time.Now().UTC().After(link.ExpiresAt) {
+			return sql.ErrNoRows
+		}
+		// The link stays valid for its own browser.
+		if !browserMatches(r, link.BrowserHash) {
+			return errOtherBrowser
+		}
+		if err := q.DeleteMagicLinks(r.Context(), link.UserID); err != nil {
+			return err
+		}
+		user, err = q.GetUserByID(r.Context(), link.UserID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "This link is invalid, was already used or has expired")
+		return
+	}
+	if errors.Is(err, errOtherBrowser) {
+		log.Printf("Refused a login link opened in another browser")
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if isSuspended(user) {
+		log.Printf("Suspended user tried to log in")
+		respondSuspended(w, user)
+		return
+	}
+	// The link stands in for the password, not for the second factor.
+	if user.TotpEnabledAt.Valid {
+		log.Printf("Login link accepted, waiting for the second factor")
+		a.respondMFARequired(w, user)
+		return
+	}
+	a.issueSession(w, r, user, "magic_link")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+// requestMagicLink asks for a login link from a new browser and returns the
+// browser's cookies along with the token mailed to email, if any.
+func (s *testServer) requestMagicLink(email string) ([]*http.Cookie, string, error) {
+	w := s.request("POST", "/api/login/magic-link", "", map[string]string{"email": email})
+	if w.Code != http.StatusAccepted {
+		return nil, "", fmt.Errorf("couldn't ask for a login link: %d %s", w.Code, w.Body.String())
+	}
+	return w.Result().Cookies(), s.mailedToken(email, auth.MagicLinkTokenPrefix), nil
+}
+
+func (s *testServer) confirmMagicLink(cookies []*http.Cookie, token string) *httptest.ResponseRecorder {
+	r := newTestRequest("POST", "/api/login/magic-link/confirm", "", map[string]string{"token": token})
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return s.serve(r)
+}
+
+// enableTOTP turns on two-factor authentication for the user logged in with
+// token and returns the secret.
+func (s *testServer) enableTOTP(token string) (string, error) {
+	w := s.request("POST", "/api/mfa/totp/enroll", token, nil)
+	if w.Code != http.StatusOK {
+		return "", fmt.Errorf("couldn't enroll: %d %s", w.Code, w.Body.String())
+	}
+	enrollment := struct {
+		Secret string `json:"secret"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &enrollment); err != nil {
+		return "", err
+	}
+	code, err := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		return "", err
+	}
+	w = s.request("POST", "/api/mfa/totp/confirm", token, map[string]string{"code": code})
+	if w.Code != http.StatusOK {
+		return "", fmt.Errorf("couldn't confirm: %d %s", w.Code, w.Body.String())
+	}
+	return enrollment.Secret, nil
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	if _, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user"); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	otherBrowser, token, err := s.requestMagicLink("jesse@breakingbad.com")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if token != "" || len(otherBrowser) == 0 {
+		t.Errorf("an email without an account should only get the browser cookie")
+		return
+	}
+
+	browser, token, err := s.requestMagicLink("walt@breakingbad.com")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if token == "" {
+		t.Errorf("expected a login link to be mailed")
+		return
+	}
+
+	if w := s.confirmMagicLink(nil, token); w.Code != http.StatusForbidden {
+		t.Errorf("expected a browser without the cookie to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.confirmMagicLink(otherBrowser, token); w.Code != http.StatusForbidden {
+		t.Errorf("expected another browser to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	w := s.confirmMagicLink(browser, token)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the link to log in, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	session := testLogin{}
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil || session.Token == "" {
+		t.Errorf("expected a session, got %s", w.Body.String())
+		return
+	}
+
+	if w := s.confirmMagicLink(browser, token); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a used link to be refused, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMagicLinkNeedsSecondFactor(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if _, err := s.enableTOTP(walt.Token); err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	browser, token, err := s.requestMagicLink("walt@breakingbad.com")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	w := s.confirmMagicLink(browser, token)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the link to be accepted, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	mfa := struct {
+		MFARequired bool `json:"mfa_required"`
+		MFAToken string `json:"mfa_token"`
+		Token string `json:"token"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &mfa); err != nil {
+		t.Errorf("couldn't decode the response: %v", err)
+		return
+	}
+	if !mfa.MFARequired || mfa.MFAToken == "" || mfa.Token != "" {
+		t.Errorf("expected to be asked for the second factor instead of a session, got %s", w.Body.String())
+	}
+}
@@ -1,12 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/breach"
 	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/NHMosko/chirpy/internal/moderation"
+	"github.com/NHMosko/chirpy/internal/oidc"
+	"github.com/NHMosko/chirpy/internal/passkey"
+	"github.com/NHMosko/chirpy/internal/throttle"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -14,8 +29,9 @@ import (
 func main() {
 	godotenv.Load()
 	platform := os.Getenv("PLATFORM")
-	jwtSecret := os.Getenv("JWTSECRET")
 	polkaKey := os.Getenv("POLKA_KEY")
+	trustProxy := os.Getenv("TRUST_PROXY") == "true"
+	verifiedEmailRequired := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
 	dbURL := os.Getenv("DB_URL")
 	db,err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -23,47 +39,439 @@ func main() {
 	}
 	dbQueries := database.New(db)
 
-	const prefix = "/app/"
+	chirpPolicy, err := loadChirpPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokenConfig, err := loadTokenConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jwtKeys, err := loadJWTKeys(tokenConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passkeys, err := passkey.New(loadPasskeyConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	oidcProvider, err := loadOIDCProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mail := loadMailer()
+
+	magicLinkURL, err := loadMagicLinkURL()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordParams, err := loadPasswordParams()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dummyPasswordHash, err := auth.HashPassword(uuid.NewString(), passwordParams)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	const filepathRoot = "."
 	const port = "8080"
 	apiCfg := apiConfig{
+		db: db,
 		dbQueries: dbQueries,
 		platform: platform,
-		jwtSecret: jwtSecret,
+		jwtKeys: jwtKeys,
+		passkeys: passkeys,
+		oidc: oidcProvider,
+		mailer: mail,
+		magicLinkURL: magicLinkURL,
+		tokenConfig: tokenConfig,
 		polkaKey: polkaKey,
+		chirpPolicy: chirpPolicy,
+		passwordPolicy: passwordPolicy,
+		passwordParams: passwordParams,
+		trustProxy: trustProxy,
+		accountThrottle: throttle.DefaultAccountPolicy(),
+		ipThrottle: throttle.DefaultIPPolicy(),
+		dummyPasswordHash: dummyPasswordHash,
+		verifiedEmailRequired: verifiedEmailRequired,
 	}
+	apiCfg.bannedTerms = moderation.NewCache(apiCfg.loadBannedTerms)
 
-	mux := http.NewServeMux()
-	mux.Handle(prefix, apiCfg.middleMetricsInc(handle(prefix, filepathRoot)))
+	server := http.Server{
+		Handler: apiCfg.routes(filepathRoot),
+		Addr: ":" + port,
+	}
 
-	mux.HandleFunc("GET /admin/metrics", apiCfg.getMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handleReset)
-	mux.HandleFunc("GET /api/healthz", getHealth)
+	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+	err = server.ListenAndServe()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirpByID)
-	mux.HandleFunc("POST /api/chirps", apiCfg.createChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
+// loadChirpPolicy reads CHIRP_LENGTH_MODE ("graphemes" or "codepoints"),
+// CHIRP_MAX_LENGTH and CHIRP_MAX_LENGTH_RED, keeping the defaults for
+// anything left unset.
+func loadChirpPolicy() (validate.ChirpPolicy, error) {
+	policy := validate.DefaultChirpPolicy()
 
-	mux.HandleFunc("POST /api/users", apiCfg.createUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.updateUser)
-	mux.HandleFunc("POST /api/login", apiCfg.login)
+	mode, err := validate.ParseCountMode(os.Getenv("CHIRP_LENGTH_MODE"))
+	if err != nil {
+		return policy, err
+	}
+	policy.Mode = mode
 
-	mux.HandleFunc("POST /api/refresh", apiCfg.handleRefresh)
-	mux.HandleFunc("POST /api/revoke", apiCfg.handleRevoke)
+	if v := os.Getenv("CHIRP_MAX_LENGTH"); v != "" {
+		policy.MaxLength, err = strconv.Atoi(v)
+		if err != nil {
+			return policy, err
+		}
+	}
+	if v := os.Getenv("CHIRP_MAX_LENGTH_RED"); v != "" {
+		policy.MaxLengthRed, err = strconv.Atoi(v)
+		if err != nil {
+			return policy, err
+		}
+	}
+	if policy.MaxLength < 1 || policy.MaxLengthRed < 1 {
+		return policy, fmt.Errorf("CHIRP_MAX_LENGTH and CHIRP_MAX_LENGTH_RED must be at least 1")
+	}
+	return policy, nil
+}
 
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebhook)
+// loadPasswordPolicy reads PASSWORD_MIN_LENGTH and PASSWORD_MIN_ENTROPY (in
+// bits), keeping the defaults for anything left unset, and checks passwords
+// against the breached password corpus in BREACHED_PASSWORDS_DIR when set.
+func loadPasswordPolicy() (validate.PasswordPolicy, error) {
+	policy := validate.DefaultPasswordPolicy()
 
-	server := http.Server{
-		Handler: mux,
-		Addr: ":" + port,
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return policy, fmt.Errorf("PASSWORD_MIN_LENGTH: %w", err)
+		}
+		if n < 1 || n > policy.MaxLength {
+			return policy, fmt.Errorf("PASSWORD_MIN_LENGTH must be between 1 and %d", policy.MaxLength)
+		}
+		policy.MinLength = n
+	}
+	if v := os.Getenv("PASSWORD_MIN_ENTROPY"); v != "" {
+		bits, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return policy, fmt.Errorf("PASSWORD_MIN_ENTROPY: %w", err)
+		}
+		if bits < 0 {
+			return policy, fmt.Errorf("PASSWORD_MIN_ENTROPY can't be negative")
+		}
+		policy.MinEntropy = bits
 	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		corpus, err := breach.Open(dir)
+		if err != nil {
+			return policy, fmt.Errorf("BREACHED_PASSWORDS_DIR: %w", err)
+		}
+		policy.Breached = corpus
+	}
+	return policy, nil
+}
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	err = server.ListenAndServe()
+// loadPasswordParams reads ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and
+// ARGON2_PARALLELISM, keeping the defaults for anything left unset. Run
+// cmd/argon2-calibrate to pick values for the machine the server runs on.
+func loadPasswordParams() (auth.PasswordParams, error) {
+	params := auth.DefaultPasswordParams()
+
+	settings := []struct {
+		env string
+		bits int
+		set func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+	for _, s := range settings {
+		v := os.Getenv(s.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(v, 10, s.bits)
+		if err != nil {
+			return params, fmt.Errorf("%s: %w", s.env, err)
+		}
+		s.set(parsed)
+	}
+	return params, params.Validate()
+}
+
+// loadTokenConfig reads JWT_ISSUER, JWT_AUDIENCE, ACCESS_TOKEN_TTL,
+// REFRESH_TOKEN_TTL and JWT_LEEWAY, keeping the defaults for anything left
+// unset. Durations use Go syntax, e.g. "15m" or "720h".
+func loadTokenConfig() (auth.TokenConfig, error) {
+	cfg := auth.DefaultTokenConfig()
+	if v := os.Getenv("JWT_ISSUER"); v != "" {
+		cfg.Issuer = v
+	}
+	if v := os.Getenv("JWT_AUDIENCE"); v != "" {
+		cfg.Audience = v
+	}
+
+	durations := []struct {
+		env string
+		value *time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", &cfg.AccessTTL},
+		{"REFRESH_TOKEN_TTL", &cfg.RefreshTTL},
+		{"JWT_LEEWAY", &cfg.Leeway},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", d.env, err)
+		}
+		if parsed < 0 || (parsed == 0 && d.env != "JWT_LEEWAY") {
+			return cfg, fmt.Errorf("%s must be positive", d.env)
+		}
+		*d.value = parsed
+	}
+	return cfg, nil
+}
+
+// loadMailer sends mail through the SMTP relay at SMTP_ADDR, logging in with
+// SMTP_USERNAME and SMTP_PASSWORD when set. Without a relay, messages are
+// written to MAIL_DIR ("mail" by default) for development. MAIL_FROM is the
+// sender address.
+func loadMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return mailer.SMTP{
+			Addr: addr,
+			From: from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+	log.Printf("SMTP_ADDR isn't set, writing emails to %s", dir)
+	return mailer.File{Dir: dir, From: from}
+}
+
+// loadMagicLinkURL reads MAGIC_LINK_URL, the frontend page login links open.
+// It gets the token in its "token" query parameter and posts it to
+// /api/login/magic-link/confirm.
+func loadMagicLinkURL() (*url.URL, error) {
+	v := os.Getenv("MAGIC_LINK_URL")
+	if v == "" {
+		v = "http://localhost:8080/app/login/magic-link"
+	}
+	link, err := url.Parse(v)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("MAGIC_LINK_URL: %w", err)
+	}
+	if link.Scheme != "https" && link.Scheme != "http" {
+		return nil, fmt.Errorf("MAGIC_LINK_URL must be an http(s) URL")
+	}
+	return link, nil
+}
+
+// loadPasskeyConfig reads WEBAUTHN_RP_ID, the domain passkeys are bound to,
+// and WEBAUTHN_RP_ORIGINS, a comma separated list of the origins the site is
+// served from. Both default to a local development setup.
+func loadPasskeyConfig() passkey.Config {
+	cfg := passkey.Config{
+		RPID: "localhost",
+		RPDisplayName: "Chirpy",
+		Origins: []string{"http://localhost:8080"},
+	}
+	if v := os.Getenv("WEBAUTHN_RP_ID"); v != "" {
+		cfg.RPID = v
+	}
+	if v := os.Getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+		cfg.Origins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.Origins = append(cfg.Origins, origin)
+			}
+		}
+	}
+	return cfg
+}
+
+// loadOIDCProvider discovers the OpenID Connect provider at OIDC_ISSUER that
+// users can log in with, as the client OIDC_CLIENT_ID with the secret
+// OIDC_CLIENT_SECRET. OIDC_REDIRECT_URI is the frontend page the provider
+// sends users back to. Without OIDC_ISSUER the login is turned off.
+func loadOIDCProvider() (*oidc.Provider, error) {
+	cfg := oidc.Config{
+		Issuer: os.Getenv("OIDC_ISSUER"),
+		ClientID: os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURI: os.Getenv("OIDC_REDIRECT_URI"),
+	}
+	if cfg.Issuer == "" {
+		return nil, nil
 	}
+	if cfg.ClientID == "" || cfg.RedirectURI == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER needs OIDC_CLIENT_ID and OIDC_REDIRECT_URI")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+	defer cancel()
+	return oidc.Discover(ctx, cfg, nil)
+}
+
+// loadJWTKeys signs access tokens with the PEM keys in JWT_KEYS_DIR, using
+// JWT_SIGNING_KEY_ID to pick one when the directory holds several private
+// keys. JWTSECRET alone keeps the old HS256 signing; set next to a key
+// directory it only verifies the HS256 tokens still in circulation, until
+// the last one it could have signed has expired.
+func loadJWTKeys(cfg auth.TokenConfig) (*auth.KeySet, error) {
+	secret := os.Getenv("JWTSECRET")
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if secret == "" {
+			return nil, fmt.Errorf("JWT_KEYS_DIR or JWTSECRET must be set")
+		}
+		return auth.NewHMACKeySet(secret), nil
+	}
+
+	keys, err := auth.LoadKeySet(dir, os.Getenv("JWT_SIGNING_KEY_ID"))
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		until := time.Now().Add(cfg.AccessTTL + cfg.Leeway)
+		keys.AddHMAC(secret, until)
+		log.Printf("Warning: JWTSECRET is set next to JWT_KEYS_DIR, HS256 tokens are accepted until %s. Remove JWTSECRET after that.",
+			until.UTC().Format(time.RFC3339))
+		time.AfterFunc(time.Until(until), func() {
+			log.Printf("HS256 tokens are no longer accepted, JWTSECRET can be removed")
+		})
+	}
+	return keys, nil
+}
+
+// routes maps every endpoint to its handler, serving the frontend files in
+// filepathRoot under /app/.
+func (a *apiConfig) routes(filepathRoot string) *http.ServeMux {
+	mux := http.NewServeMux()
+	const prefix = "/app/"
+	mux.Handle(prefix, a.middleMetricsInc(handle(prefix, filepathRoot)))
+
+	mux.HandleFunc("GET /admin/metrics", a.requirePermission(permMetricsRead, a.getMetrics))
+	mux.HandleFunc("POST /admin/reset", a.requirePermission(permSystemReset, a.handleReset))
+	mux.HandleFunc("GET /api/healthz", getHealth)
+	mux.HandleFunc("GET /.well-known/jwks.json", a.getJWKS)
+
+	mux.HandleFunc("GET /admin/roles", a.requirePermission(permRolesManage, a.listRoles))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", a.requirePermission(permRolesManage, a.setUserRole))
+
+	mux.HandleFunc("GET /admin/users", a.requirePermission(permUsersManage, a.searchUsers))
+	mux.HandleFunc("GET /admin/users/{userID}", a.requirePermission(permUsersManage, a.getAdminUser))
+	mux.HandleFunc("DELETE /admin/users/{userID}", a.requirePermission(permUsersManage, a.deleteAdminUser))
+	mux.HandleFunc("POST /admin/users/{userID}/password-reset", a.requirePermission(permUsersManage, a.forcePasswordReset))
+	mux.HandleFunc("POST /admin/users/{userID}/revoke-sessions", a.requirePermission(permUsersManage, a.revokeUserSessions))
+	mux.HandleFunc("PUT /admin/users/{userID}/chirpy-red", a.requirePermission(permUsersManage, a.setUserChirpyRed))
+
+	mux.HandleFunc("GET /admin/banned-terms", a.requirePermission(permBannedTermsManage, a.listBannedTerms))
+	mux.HandleFunc("POST /admin/banned-terms", a.requirePermission(permBannedTermsManage, a.createBannedTerm))
+	mux.HandleFunc("GET /admin/banned-terms/{termID}", a.requirePermission(permBannedTermsManage, a.getBannedTerm))
+	mux.HandleFunc("PUT /admin/banned-terms/{termID}", a.requirePermission(permBannedTermsManage, a.updateBannedTerm))
+	mux.HandleFunc("DELETE /admin/banned-terms/{termID}", a.requirePermission(permBannedTermsManage, a.deleteBannedTerm))
+
+	mux.HandleFunc("GET /admin/reports", a.requirePermission(permReportsManage, a.listReports))
+	mux.HandleFunc("POST /admin/reports/{reportID}/resolve", a.requirePermission(permReportsManage, a.resolveReport))
+	mux.HandleFunc("POST /admin/reports/{reportID}/dismiss", a.requirePermission(permReportsManage, a.dismissReport))
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/moderate", a.requirePermission(permContentModerate, a.moderateChirp))
+	mux.HandleFunc("POST /admin/users/{userID}/moderate", a.requirePermission(permContentModerate, a.moderateUser))
+	mux.HandleFunc("GET /admin/moderation-log", a.requirePermission(permModerationLogRead, a.getModerationLog))
+
+	mux.HandleFunc("GET /admin/lockouts", a.requirePermission(permLockoutsManage, a.listLockouts))
+	mux.HandleFunc("DELETE /admin/lockouts/{kind}/{subject}", a.requirePermission(permLockoutsManage, a.clearLockout))
+
+	mux.HandleFunc("GET /admin/audit", a.requirePermission(permAuditRead, a.getAuditLog))
+
+	mux.HandleFunc("GET /api/chirps", a.getChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", a.getChirpByID)
+	mux.HandleFunc("POST /api/chirps", a.requireAuth(auth.ScopeChirpsWrite, a.createChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", a.requireAuth(auth.ScopeChirpsWrite, a.deleteChirp))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", a.requireAuth(auth.ScopeChirpsWrite, a.reportChirp))
+
+	mux.HandleFunc("POST /api/users", a.createUser)
+	mux.HandleFunc("PUT /api/users", a.requireAuth("", a.updateUser))
+	mux.HandleFunc("POST /api/users/verify-email", a.verifyEmail)
+	mux.HandleFunc("POST /api/users/verify-email/resend", a.requireAuth("", a.resendEmailVerification))
+	mux.HandleFunc("POST /api/users/{userID}/report", a.requireAuth(auth.ScopeChirpsWrite, a.reportUser))
+	mux.HandleFunc("GET /api/users/me/security-events", a.requireAuth("", a.getSecurityEvents))
+	mux.HandleFunc("GET /api/warnings", a.requireAuth(auth.ScopeProfileRead, a.listWarnings))
+	mux.HandleFunc("POST /api/login", a.login)
+	mux.HandleFunc("POST /api/login/mfa", a.loginMFA)
+	mux.HandleFunc("POST /api/login/magic-link", a.requestMagicLink)
+	mux.HandleFunc("POST /api/login/magic-link/confirm", a.confirmMagicLink)
+	mux.HandleFunc("POST /api/login/oidc/begin", a.beginOIDCLogin)
+	mux.HandleFunc("POST /api/login/oidc/finish", a.finishOIDCLogin)
+	mux.HandleFunc("POST /api/password-reset/request", a.requestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", a.confirmPasswordReset)
+
+	mux.HandleFunc("POST /api/mfa/totp/enroll", a.requireAuth("", a.enrollTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/confirm", a.requireAuth("", a.confirmTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/disable", a.requireAuth("", a.disableTOTP))
+	mux.HandleFunc("POST /api/mfa/recovery-codes", a.requireAuth("", a.regenerateRecoveryCodes))
+
+	mux.HandleFunc("POST /api/webauthn/register/begin", a.requireAuth("", a.beginPasskeyRegistration))
+	mux.HandleFunc("POST /api/webauthn/register/finish", a.requireAuth("", a.finishPasskeyRegistration))
+	mux.HandleFunc("POST /api/webauthn/login/begin", a.beginPasskeyLogin)
+	mux.HandleFunc("POST /api/webauthn/login/finish", a.finishPasskeyLogin)
+	mux.HandleFunc("GET /api/webauthn/credentials", a.requireAuth("", a.listPasskeys))
+	mux.HandleFunc("DELETE /api/webauthn/credentials/{credentialID}", a.requireAuth("", a.deletePasskey))
+
+	mux.HandleFunc("GET /api/muted-words", a.requireAuth(auth.ScopeProfileRead, a.listMutedWords))
+	mux.HandleFunc("POST /api/muted-words", a.requireAuth(auth.ScopeProfileWrite, a.createMutedWord))
+	mux.HandleFunc("DELETE /api/muted-words/{mutedWordID}", a.requireAuth(auth.ScopeProfileWrite, a.deleteMutedWord))
+
+	mux.HandleFunc("POST /api/refresh", a.handleRefresh)
+	mux.HandleFunc("POST /api/revoke", a.handleRevoke)
+
+	mux.HandleFunc("GET /api/sessions", a.requireAuth("", a.listSessions))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", a.requireAuth("", a.revokeSession))
+	mux.HandleFunc("POST /api/sessions/revoke-all", a.requireAuth("", a.revokeAllSessions))
+
+	mux.HandleFunc("POST /api/tokens", a.requireAuth("", a.createPersonalAccessToken))
+	mux.HandleFunc("GET /api/tokens", a.requireAuth("", a.listPersonalAccessTokens))
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", a.requireAuth("", a.deletePersonalAccessToken))
+
+	mux.HandleFunc("POST /api/oauth/clients", a.requireAuth("", a.createOAuthClient))
+	mux.HandleFunc("GET /api/oauth/clients", a.requireAuth("", a.listOAuthClients))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", a.requireAuth("", a.deleteOAuthClient))
+	mux.HandleFunc("GET /api/oauth/authorize", a.requireAuth("", a.describeAuthorization))
+	mux.HandleFunc("POST /api/oauth/authorize", a.requireAuth("", a.authorize))
+	mux.HandleFunc("POST /oauth/token", a.oauthToken)
+	mux.HandleFunc("POST /oauth/revoke", a.oauthRevoke)
+	mux.HandleFunc("POST /oauth/introspect", a.oauthIntrospect)
+
+	mux.HandleFunc("POST /api/polka/webhooks", a.polkaWebhook)
+	return mux
 }
 
 func handle(prefix string, filepathRoot string) http.Handler {
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+)
+
+const recoveryCodeCount = 10
+
+// enrollTOTP starts TOTP enrolment with a fresh secret. Nothing is enforced
+// until the user proves their app works by confirming a first code.
+func (a *apiConfig) enrollTOTP(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = a.dbQueries.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		ID: user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type enrollResponse struct {
+		Secret string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+	respondWithJSON(w, http.StatusOK, enrollResponse{
+		Secret: secret,
+		OtpauthURI: auth.TOTPURI(secret, a.tokenConfig.Issuer, user.Email),
+	})
+}
+
+type secondFactorInput struct {
+	Code string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// confirmTOTP enables TOTP once the first code checks out and hands out the
+// recovery codes, which are never shown again.
+func (a *apiConfig) confirmTOTP(w http.ResponseWriter, r *http.Request, user database.User) {
+	input := secondFactorInput{}
+	decodeInput(w, r, &input)
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Start the enrolment first")
+		return
+	}
+
+	var codes []string
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		ok, err := checkTOTP(r.Context(), q, user, input.Code)
+		if err != nil || !ok {
+			return err
+		}
+		if _, err := q.EnableTOTP(r.Context(), user.ID); err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(r.Context(), q, user)
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{Event: auditTOTPEnabled, ActorID: user.ID, UserID: user.ID})
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if codes == nil {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	}
+
+	log.Printf("User %v enabled two-factor authentication", user.ID)
+	respondWithJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// disableTOTP turns two-factor authentication off. It takes a current code
+// or a recovery code, a stolen access token alone isn't enough.
+func (a *apiConfig) disableTOTP(w http.ResponseWriter, r *http.Request, user database.User) {
+	input := secondFactorInput{}
+	decodeInput(w, r, &input)
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled")
+		return
+	}
+
+	disabled := false
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		ok, err := checkSecondFactor(r.Context(), q, user, input)
+		if err != nil || !ok {
+			return err
+		}
+		if err := q.DisableTOTP(r.Context(), user.ID); err != nil {
+			return err
+		}
+		disabled = true
+		if err := q.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{Event: auditTOTPDisabled, ActorID: user.ID, UserID: user.ID})
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !disabled {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	}
+
+	log.Printf("User %v disabled two-factor authentication", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// regenerateRecoveryCodes replaces every recovery code, used or not.
+func (a *apiConfig) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, user database.User) {
+	input := secondFactorInput{}
+	decodeInput(w, r, &input)
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled")
+		return
+	}
+
+	var codes []string
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		ok, err := checkTOTP(r.Context(), q, user, input.Code)
+		if err != nil || !ok {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(r.Context(), q, user)
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{Event: auditRecoveryCodesRegenerated, ActorID: user.ID, UserID: user.ID})
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if codes == nil {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// loginMFA is the second step of a login for users with two-factor
+// authentication: the MFA token from login plus a code or a recovery code
+// gets the access and refresh tokens.
+func (a *apiConfig) loginMFA(w http.ResponseWriter, r *http.Request) {
+	type mfaInput struct {
+		MFAToken string `json:"mfa_token"`
+		secondFactorInput
+	}
+	input := mfaInput{}
+	decodeInput(w, r, &input)
+
+	userID, version, err := auth.ValidateMFAToken(input.MFAToken, a.jwtKeys, a.tokenConfig)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Wrong codes count against the account like wrong passwords.
+	user, err := a.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "This login is no longer valid, please start again")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	attempt, ok := a.reserveLoginAttempt(w, r, a.loginSubjects(r, user.Email))
+	if !ok {
+		return
+	}
+
+	passed := false
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		user, err = q.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if user.TokenVersion != version || !user.TotpEnabledAt.Valid {
+			return sql.ErrNoRows
+		}
+		passed, err = checkSecondFactor(r.Context(), q, user, input.secondFactorInput)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "This login is no longer valid, please start again")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !passed {
+		failLoginAttempt(attempt)
+		a.audit(r, auditEvent{
+			Event: auditLoginFailed,
+			UserID: user.ID,
+			Metadata: map[string]any{"method": "mfa"},
+		})
+		log.Printf("Failed second factor for user %v", user.ID)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	}
+	if err := a.clearLoginFailures(r.Context(), attempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isSuspended(user) {
+		respondSuspended(w, user)
+		return
+	}
+
+	a.issueSession(w, r, user, "mfa")
+}
+
+// checkTOTP checks code against the user's secret and burns its time step,
+// so every code works once.
+func checkTOTP(ctx context.Context, q *database.Queries, user database.User, code string) (bool, error) {
+	if !user.TotpSecret.Valid {
+		return false, nil
+	}
+	step, ok := auth.CheckTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	used, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		ID: user.ID,
+		TotpLastStep: step,
+	})
+	return used == 1, err
+}
+
+func checkSecondFactor(ctx context.Context, q *database.Queries, user database.User, input secondFactorInput) (bool, error) {
+	if input.RecoveryCode != "" {
+		used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID: user.ID,
+			CodeHash: auth.HashRecoveryCode(input.RecoveryCode),
+		})
+		return used == 1, err
+	}
+	return checkTOTP(ctx, q, user, input.Code)
+}
+
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, user database.User) ([]string, error) {
+	if err := q.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID: user.ID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/moderation"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// muteScope is where a muted word applies. Only the chirp listings (home)
+// exist today, notifications and search are stored for when they land.
+type muteScope string
+
+const (
+	muteScopeHome muteScope = "home"
+	muteScopeNotifications muteScope = "notifications"
+	muteScopeSearch muteScope = "search"
+)
+
+const (
+	muteActionHide = "hide"
+	muteActionCollapse = "collapse"
+)
+
+type mutedWordResponse struct {
+	Id uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Phrase string `json:"phrase"`
+	Action string `json:"action"`
+	Scopes []muteScope `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func convertMutedWord(mute database.MutedWord) mutedWordResponse {
+	mutedData := mutedWordResponse{
+		Id: mute.ID,
+		CreatedAt: mute.CreatedAt,
+		UpdatedAt: mute.UpdatedAt,
+		Phrase: mute.Phrase,
+		Action: mute.Action,
+		Scopes: []muteScope{},
+	}
+	if mute.MuteHome {
+		mutedData.Scopes = append(mutedData.Scopes, muteScopeHome)
+	}
+	if mute.MuteNotifications {
+		mutedData.Scopes = append(mutedData.Scopes, muteScopeNotifications)
+	}
+	if mute.MuteSearch {
+		mutedData.Scopes = append(mutedData.Scopes, muteScopeSearch)
+	}
+	if mute.ExpiresAt.Valid {
+		mutedData.ExpiresAt = &mute.ExpiresAt.Time
+	}
+	return mutedData
+}
+
+func (a *apiConfig) listMutedWords(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID := user.ID
+
+	mutes, err := a.dbQueries.ListMutedWords(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	mutedData := []mutedWordResponse{}
+	for _, mute := range mutes {
+		mutedData = append(mutedData, convertMutedWord(mute))
+	}
+	respondWithJSON(w, http.StatusOK, mutedData)
+}
+
+func (a *apiConfig) createMutedWord(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID := user.ID
+
+	type muteInput struct {
+		Phrase string `json:"phrase"`
+		Action string `json:"action"`
+		Scopes []muteScope `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	input := muteInput{}
+	decodeInput(w, r, &input)
+
+	var errs validate.Errors
+	rule := moderation.Rule{Term: input.Phrase, Match: moderation.MatchWord}
+	if err := rule.Validate(); err != nil {
+		errs.Add("phrase", "invalid", err.Error())
+	}
+
+	if input.Action == "" {
+		input.Action = muteActionHide
+	}
+	if input.Action != muteActionHide && input.Action != muteActionCollapse {
+		errs.Add("action", "invalid", `Action must be "hide" or "collapse"`)
+	}
+
+	params := database.CreateMutedWordParams{
+		UserID: userID,
+		Phrase: input.Phrase,
+		Action: input.Action,
+	}
+	if len(input.Scopes) == 0 {
+		input.Scopes = []muteScope{muteScopeHome, muteScopeNotifications, muteScopeSearch}
+	}
+	for _, scope := range input.Scopes {
+		switch scope {
+		case muteScopeHome:
+			params.MuteHome = true
+		case muteScopeNotifications:
+			params.MuteNotifications = true
+		case muteScopeSearch:
+			params.MuteSearch = true
+		default:
+			errs.Add("scopes", "invalid", "Unknown scope " + string(scope))
+		}
+	}
+
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			errs.Add("expires_at", "in_past", "Expiry must be in the future")
+		}
+		params.ExpiresAt = sql.NullTime{Time: input.ExpiresAt.UTC(), Valid: true}
+	}
+
+	if err := errs.Err(); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	mute, err := a.dbQueries.CreateMutedWord(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Muted word added")
+	respondWithJSON(w, http.StatusCreated, convertMutedWord(mute))
+}
+
+func (a *apiConfig) deleteMutedWord(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID := user.ID
+
+	muteID, err := uuid.Parse(r.PathValue("mutedWordID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := a.dbQueries.DeleteMutedWord(r.Context(), database.DeleteMutedWordParams{
+		ID: muteID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find muted word on database")
+		return
+	}
+
+	log.Printf("Muted word removed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyMutes hides or collapses the chirps that match the viewer's active
+// muted words for scope. Only the response is changed, stored chirps are not.
+func (a *apiConfig) applyMutes(ctx context.Context, viewerID uuid.UUID, scope muteScope, chirps []chirpResponse) ([]chirpResponse, error) {
+	mutes, err := a.dbQueries.ListActiveMutedWords(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return muteChirps(viewerID, scope, mutes, chirps)
+}
+
+// muteChirps applies mutes to chirps. When a chirp matches several phrases
+// and any of them hides, it is hidden; otherwise it is collapsed and the
+// matched phrases are listed.
+func muteChirps(viewerID uuid.UUID, scope muteScope, mutes []database.MutedWord, chirps []chirpResponse) ([]chirpResponse, error) {
+	actions := map[string]string{}
+	var rules []moderation.Rule
+	for _, mute := range mutes {
+		inScope := (scope == muteScopeHome && mute.MuteHome) ||
+			(scope == muteScopeNotifications && mute.MuteNotifications) ||
+			(scope == muteScopeSearch && mute.MuteSearch)
+		if !inScope {
+			continue
+		}
+		if _, ok := actions[mute.Phrase]; !ok {
+			rules = append(rules, moderation.Rule{Term: mute.Phrase, Match: moderation.MatchWord})
+		}
+		if actions[mute.Phrase] != muteActionHide {
+			actions[mute.Phrase] = mute.Action
+		}
+	}
+	if len(rules) == 0 {
+		return chirps, nil
+	}
+
+	filter, err := moderation.NewFilter(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []chirpResponse{}
+	for _, chirp := range chirps {
+		// Your own chirps are never muted for you.
+		if chirp.UserId == viewerID {
+			visible = append(visible, chirp)
+			continue
+		}
+
+		hide := false
+		var matched []string
+		for _, rule := range filter.Matches(chirp.Body) {
+			matched = append(matched, rule.Term)
+			if actions[rule.Term] == muteActionHide {
+				hide = true
+			}
+		}
+		if hide {
+			continue
+		}
+		if len(matched) > 0 {
+			chirp.Collapsed = true
+			chirp.MutedWords = matched
+		}
+		visible = append(visible, chirp)
+	}
+	return visible, nil
+}
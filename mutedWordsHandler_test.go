@@ -0,0 +1,112 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestMuteChirps(t *testing.T) {
+	viewer := uuid.New()
+	author := uuid.New()
+
+	mute := func(phrase, action string, home, search bool) database.MutedWord {
+		return database.MutedWord{
+			Phrase: phrase,
+			Action: action,
+			MuteHome: home,
+			MuteSearch: search,
+		}
+	}
+
+	cases := []struct {
+		name string
+		mutes []database.MutedWord
+		author uuid.UUID
+		body string
+		hidden bool
+		collapsed []string
+	}{
+		{
+			name: "no mutes",
+			author: author,
+			body: "spoilers ahead",
+		},
+		{
+			name: "hide",
+			mutes: []database.MutedWord{mute("spoilers", muteActionHide, true, true)},
+			author: author,
+			body: "Spoilers ahead",
+			hidden: true,
+		},
+		{
+			name: "collapse",
+			mutes: []database.MutedWord{mute("spoilers", muteActionCollapse, true, true)},
+			author: author,
+			body: "spoilers ahead",
+			collapsed: []string{"spoilers"},
+		},
+		{
+			name: "hide beats collapse",
+			mutes: []database.MutedWord{
+				mute("spoilers", muteActionCollapse, true, true),
+				mute("finale", muteActionHide, true, true),
+			},
+			author: author,
+			body: "finale spoilers",
+			hidden: true,
+		},
+		{
+			name: "same phrase hide beats collapse",
+			mutes: []database.MutedWord{
+				mute("spoilers", muteActionHide, true, true),
+				mute("spoilers", muteActionCollapse, true, true),
+			},
+			author: author,
+			body: "spoilers",
+			hidden: true,
+		},
+		{
+			name: "out of scope",
+			mutes: []database.MutedWord{mute("spoilers", muteActionHide, false, true)},
+			author: author,
+			body: "spoilers ahead",
+		},
+		{
+			name: "own chirps are never muted",
+			mutes: []database.MutedWord{mute("spoilers", muteActionHide, true, true)},
+			author: viewer,
+			body: "spoilers ahead",
+		},
+		{
+			name: "whole words only",
+			mutes: []database.MutedWord{mute("spoil", muteActionHide, true, true)},
+			author: author,
+			body: "spoilers ahead",
+		},
+	}
+
+	for _, c := range cases {
+		chirps := []chirpResponse{{Id: uuid.New(), UserId: c.author, Body: c.body}}
+		got, err := muteChirps(viewer, muteScopeHome, c.mutes, chirps)
+		if err != nil {
+			t.Errorf("%s: couldn't apply mutes: %v", c.name, err)
+			continue
+		}
+		if c.hidden {
+			if len(got) != 0 {
+				t.Errorf("%s: chirp should have been hidden", c.name)
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Errorf("%s: chirp shouldn't have been hidden", c.name)
+			continue
+		}
+		if got[0].Collapsed != (len(c.collapsed) > 0) || !slices.Equal(got[0].MutedWords, c.collapsed) {
+			t.Errorf("%s: expected collapsed by %v, got %v (%v)", c.name, c.collapsed, got[0].Collapsed, got[0].MutedWords)
+		}
+	}
+}
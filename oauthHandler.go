@@ -0,0 +1,713 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/oauth"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	// oauthCodeTTL is how long a client has to trade an authorization code.
+	oauthCodeTTL = 5 * time.Minute
+	maxClientNameLength = 100
+	maxRedirectURIs = 10
+)
+
+type oauthClientResponse struct {
+	ClientId string `json:"client_id"`
+	Name string `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes []string `json:"scopes"`
+	Public bool `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+	// ClientSecret is only sent when a confidential client is registered.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func toOAuthClientResponse(client database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientId: client.ID,
+		Name: client.Name,
+		RedirectURIs: strings.Fields(client.RedirectUris),
+		Scopes: strings.Fields(client.Scope),
+		Public: !client.SecretHash.Valid,
+		CreatedAt: client.CreatedAt,
+	}
+}
+
+// createOAuthClient registers a third-party app. Public clients, like native
+// and browser apps, can't keep a secret and only get a client_id; they have
+// to use PKCE like everyone else.
+func (a *apiConfig) createOAuthClient(w http.ResponseWriter, r *http.Request, user database.User) {
+	type clientInput struct {
+		Name string `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes []string `json:"scopes"`
+		Public bool `json:"public"`
+	}
+	input := clientInput{}
+	decodeInput(w, r, &input)
+
+	var errs validate.Errors
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		errs.Add("name", "empty", "Name can't be empty")
+	} else if len(input.Name) > maxClientNameLength {
+		errs.Add("name", "too_long", fmt.Sprintf("Name can't be longer than %d characters", maxClientNameLength))
+	}
+
+	if len(input.RedirectURIs) == 0 {
+		errs.Add("redirect_uris", "empty", "A client needs at least one redirect URI")
+	} else if len(input.RedirectURIs) > maxRedirectURIs {
+		errs.Add("redirect_uris", "too_many", fmt.Sprintf("A client can't have more than %d redirect URIs", maxRedirectURIs))
+	}
+	for _, uri := range input.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(uri); err != nil {
+			errs.Add("redirect_uris", "invalid", err.Error())
+			break
+		}
+	}
+
+	scopes, err := auth.ParseScopes(input.Scopes)
+	if err != nil {
+		errs.Add("scopes", "invalid", err.Error())
+	} else if len(scopes) == 0 {
+		errs.Add("scopes", "empty", "A client needs at least one scope")
+	}
+
+	if err := errs.Err(); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	secret, err := auth.MakeClientSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	params := database.CreateOAuthClientParams{
+		ID: secret.Selector,
+		OwnerID: user.ID,
+		Name: input.Name,
+		RedirectUris: strings.Join(input.RedirectURIs, " "),
+		Scope: strings.Join(scopes, " "),
+	}
+	if !input.Public {
+		params.SecretHash = sql.NullString{String: secret.VerifierHash, Valid: true}
+	}
+	client, err := a.dbQueries.CreateOAuthClient(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("User %v registered OAuth client %s", user.ID, client.ID)
+	clientData := toOAuthClientResponse(client)
+	if !input.Public {
+		clientData.ClientSecret = secret.Token
+	}
+	respondWithJSON(w, http.StatusCreated, clientData)
+}
+
+func (a *apiConfig) listOAuthClients(w http.ResponseWriter, r *http.Request, user database.User) {
+	clients, err := a.dbQueries.ListOAuthClients(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	clientsData := []oauthClientResponse{}
+	for _, client := range clients {
+		clientsData = append(clientsData, toOAuthClientResponse(client))
+	}
+	respondWithJSON(w, http.StatusOK, clientsData)
+}
+
+// deleteOAuthClient removes an app along with its codes and refresh tokens,
+// which ends every grant it had: the access tokens already issued to it are
+// refused from then on, both because their session is gone and because
+// authenticate checks the client still exists.
+func (a *apiConfig) deleteOAuthClient(w http.ResponseWriter, r *http.Request, user database.User) {
+	clientID := r.PathValue("clientID")
+	deleted, err := a.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID: clientID,
+		OwnerID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find an OAuth client with that id")
+		return
+	}
+
+	log.Printf("User %v deleted OAuth client %s", user.ID, clientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizationRequest is the request of RFC 6749 section 4.1.1, with the
+// PKCE parameters of RFC 7636.
+type authorizationRequest struct {
+	ResponseType string `json:"response_type"`
+	ClientID string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri"`
+	Scope string `json:"scope"`
+	State string `json:"state"`
+	CodeChallenge string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// authorizationRedirect tells the frontend where to send the user back to.
+// Errors are repeated outside the redirect for it to show.
+type authorizationRedirect struct {
+	Error string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	RedirectTo string `json:"redirect_to"`
+}
+
+// checkAuthorizationRequest validates req. While the client or redirect URI
+// don't check out nothing may be sent to the redirect URI, so those errors
+// are returned as err and shown to the user. Anything wrong after that goes
+// back to the client through the redirect, as redirectErr.
+func (a *apiConfig) checkAuthorizationRequest(ctx context.Context, req authorizationRequest) (database.OauthClient, []string, *oauth.Error, error) {
+	client, err := a.dbQueries.GetOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, nil, nil, oauth.Errorf(oauth.ErrInvalidRequest, "Unknown client_id")
+	}
+	if err != nil {
+		return database.OauthClient{}, nil, nil, err
+	}
+	if !oauth.MatchRedirectURI(strings.Fields(client.RedirectUris), req.RedirectURI) {
+		return database.OauthClient{}, nil, nil, oauth.Errorf(oauth.ErrInvalidRequest, "redirect_uri isn't registered for this client")
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, oauth.Errorf(oauth.ErrUnsupportedResponseType, "Only the code response type is supported"), nil
+	}
+	if req.CodeChallengeMethod != oauth.ChallengeMethodS256 || !oauth.ValidChallenge(req.CodeChallenge) {
+		return client, nil, oauth.Errorf(oauth.ErrInvalidRequest, "A PKCE code_challenge with the S256 method is required"), nil
+	}
+	scopes, err := oauth.NarrowScope(req.Scope, strings.Fields(client.Scope))
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		return client, nil, oauthErr, nil
+	}
+	if err != nil {
+		return client, nil, nil, err
+	}
+	return client, scopes, nil, nil
+}
+
+func redirectWithError(req authorizationRequest, oauthErr *oauth.Error) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return oauth.RedirectWith(req.RedirectURI, params)
+}
+
+// respondAuthorizationError answers a request that failed checkAuthorizationRequest.
+func respondAuthorizationError(w http.ResponseWriter, req authorizationRequest, redirectErr *oauth.Error, err error) {
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		respondWithJSON(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusBadRequest, authorizationRedirect{
+		Error: redirectErr.Code,
+		ErrorDescription: redirectErr.Description,
+		RedirectTo: redirectWithError(req, redirectErr),
+	})
+}
+
+// describeAuthorization checks an authorization request the frontend was
+// sent and describes it for the consent screen: which app wants which
+// scopes.
+func (a *apiConfig) describeAuthorization(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+	req := authorizationRequest{
+		ResponseType: query.Get("response_type"),
+		ClientID: query.Get("client_id"),
+		RedirectURI: query.Get("redirect_uri"),
+		Scope: query.Get("scope"),
+		State: query.Get("state"),
+		CodeChallenge: query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	client, scopes, redirectErr, err := a.checkAuthorizationRequest(r.Context(), req)
+	if redirectErr != nil || err != nil {
+		respondAuthorizationError(w, req, redirectErr, err)
+		return
+	}
+
+	type consentResponse struct {
+		ClientId string `json:"client_id"`
+		ClientName string `json:"client_name"`
+		Scopes []string `json:"scopes"`
+		RedirectURI string `json:"redirect_uri"`
+	}
+	respondWithJSON(w, http.StatusOK, consentResponse{
+		ClientId: client.ID,
+		ClientName: client.Name,
+		Scopes: scopes,
+		RedirectURI: req.RedirectURI,
+	})
+}
+
+// authorize records the user's answer on the consent screen. Either way the
+// frontend gets the redirect that takes the user back to the app, with an
+// authorization code if they approved.
+func (a *apiConfig) authorize(w http.ResponseWriter, r *http.Request, user database.User) {
+	type authorizeInput struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+	input := authorizeInput{}
+	decodeInput(w, r, &input)
+	req := input.authorizationRequest
+
+	client, scopes, redirectErr, err := a.checkAuthorizationRequest(r.Context(), req)
+	if redirectErr != nil || err != nil {
+		respondAuthorizationError(w, req, redirectErr, err)
+		return
+	}
+	if !input.Approve {
+		log.Printf("User %v denied OAuth client %s", user.ID, client.ID)
+		respondWithJSON(w, http.StatusOK, authorizationRedirect{
+			RedirectTo: redirectWithError(req, oauth.Errorf(oauth.ErrAccessDenied, "The user denied the request")),
+		})
+		return
+	}
+
+	if err := a.dbQueries.DeleteExpiredOAuthAuthorizationCodes(r.Context()); err != nil {
+		log.Printf("Couldn't delete expired authorization codes: %v", err)
+	}
+	code, err := auth.MakeAuthorizationCode()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = a.dbQueries.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		ID: code.Selector,
+		CodeHash: code.VerifierHash,
+		ClientID: client.ID,
+		UserID: user.ID,
+		RedirectUri: req.RedirectURI,
+		Scope: strings.Join(scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt: time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	params := url.Values{"code": {code.Token}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	a.audit(r, auditEvent{
+		Event: auditOAuthConsented,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"client_id": client.ID, "scope": strings.Join(scopes, " ")},
+	})
+	log.Printf("User %v authorized OAuth client %s", user.ID, client.ID)
+	respondWithJSON(w, http.StatusOK, authorizationRedirect{
+		RedirectTo: oauth.RedirectWith(req.RedirectURI, params),
+	})
+}
+
+// respondWithOAuthError answers the token, revocation and introspection
+// endpoints as RFC 6749 section 5.2 describes.
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthErr *oauth.Error) {
+	w.Header().Set("Cache-Control", "no-store")
+	if oauthErr.Code == oauth.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		code = http.StatusUnauthorized
+	}
+	respondWithJSON(w, code, oauthErr)
+}
+
+// authenticateClient identifies the client calling the token, revocation or
+// introspection endpoint. Confidential clients send their secret with HTTP
+// Basic or in the form, public ones only their client_id.
+func (a *apiConfig) authenticateClient(r *http.Request) (database.OauthClient, *oauth.Error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes both before Basic encoding.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	invalid := oauth.Errorf(oauth.ErrInvalidClient, "Client authentication failed")
+	if clientID == "" {
+		return database.OauthClient{}, invalid
+	}
+	client, err := a.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, invalid
+	}
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, invalid
+		}
+		return client, nil
+	}
+	secretID, verifier, err := auth.ParseClientSecret(secret)
+	if err != nil || secretID != client.ID || !auth.CheckVerifier(verifier, client.SecretHash.String) {
+		return database.OauthClient{}, invalid
+	}
+	return client, nil
+}
+
+// oauthToken is the token endpoint of RFC 6749 section 3.2.
+func (a *apiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidRequest, "%v", err))
+		return
+	}
+	client, oauthErr := a.authenticateClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		a.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		a.refreshClientToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest,
+			oauth.Errorf(oauth.ErrUnsupportedGrantType, "Only authorization_code and refresh_token are supported"))
+	}
+}
+
+// exchangeAuthorizationCode trades a code for tokens once. A code presented
+// again was intercepted, so the tokens it was traded for are revoked.
+func (a *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	selector, verifier, err := auth.ParseAuthorizationCode(r.PostFormValue("code"))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidGrant, "%v", err))
+		return
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var grant database.OauthAuthorizationCode
+	var user database.User
+	var result *oauth.Error
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		grant, err = q.GetOAuthAuthorizationCodeForUpdate(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if !auth.CheckVerifier(verifier, grant.CodeHash) || grant.ClientID != client.ID {
+			return sql.ErrNoRows
+		}
+		if grant.UsedAt.Valid {
+			result = oauth.Errorf(oauth.ErrInvalidGrant, "This authorization code has already been used")
+			_, err = q.RevokeRefreshTokenFamily(r.Context(), grant.FamilyID)
+			return err
+		}
+		if !grant.ExpiresAt.After(time.Now().UTC()) {
+			result = oauth.Errorf(oauth.ErrInvalidGrant, "This authorization code has expired")
+			return nil
+		}
+		if r.PostFormValue("redirect_uri") != grant.RedirectUri {
+			result = oauth.Errorf(oauth.ErrInvalidGrant, "redirect_uri doesn't match the authorization request")
+			return nil
+		}
+		if !oauth.VerifyPKCE(r.PostFormValue("code_verifier"), grant.CodeChallenge) {
+			result = oauth.Errorf(oauth.ErrInvalidGrant, "code_verifier doesn't match the code_challenge")
+			return nil
+		}
+
+		user, err = q.GetUserByID(r.Context(), grant.UserID)
+		if err != nil {
+			return err
+		}
+		if isSuspended(user) {
+			result = oauth.Errorf(oauth.ErrInvalidGrant, "This account is suspended")
+			return nil
+		}
+
+		if err := q.UseOAuthAuthorizationCode(r.Context(), grant.ID); err != nil {
+			return err
+		}
+		_, err = q.RegisterRefreshToken(r.Context(), database.RegisterRefreshTokenParams{
+			ID: refreshToken.Selector,
+			TokenHash: refreshToken.VerifierHash,
+			UserID: grant.UserID,
+			ExpiresAt: time.Now().UTC().Add(a.tokenConfig.RefreshTTL),
+			FamilyID: grant.FamilyID,
+			UserAgent: r.UserAgent(),
+			Ip: a.clientIP(r),
+			ClientID: sql.NullString{String: client.ID, Valid: true},
+			Scope: grant.Scope,
+		})
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{
+			Event: auditOAuthGranted,
+			UserID: user.ID,
+			Metadata: map[string]any{"client_id": client.ID, "scope": grant.Scope, "session_id": grant.FamilyID},
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidGrant, "Unknown authorization code"))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result != nil {
+		if grant.UsedAt.Valid {
+			log.Printf("Authorization code reuse detected, revoked token family %v", grant.FamilyID)
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, result)
+		return
+	}
+
+	log.Printf("OAuth client %s got tokens for user %v", client.ID, user.ID)
+	a.respondWithClientTokens(w, user, client, grant.FamilyID, strings.Fields(grant.Scope), refreshToken.Token)
+}
+
+// refreshClientToken rotates a client's refresh token like handleRefresh
+// does for logins. The client may ask for less scope than it was granted.
+func (a *apiConfig) refreshClientToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	token := r.PostFormValue("refresh_token")
+	clientID := sql.NullString{String: client.ID, Valid: true}
+
+	// The scope is checked first so that a bad request doesn't cost the
+	// client its refresh token.
+	var scopes []string
+	if requested := r.PostFormValue("scope"); requested != "" {
+		selector, verifier, err := auth.ParseRefreshToken(token)
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidGrant, "%v", errUnknownRefreshToken))
+			return
+		}
+		current, err := a.dbQueries.GetRefreshToken(r.Context(), selector)
+		if err != nil || !auth.CheckVerifier(verifier, current.TokenHash) || current.ClientID != clientID {
+			respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidGrant, "%v", errUnknownRefreshToken))
+			return
+		}
+		scopes, err = oauth.NarrowScope(requested, strings.Fields(current.Scope))
+		var oauthErr *oauth.Error
+		if errors.As(err, &oauthErr) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthErr)
+			return
+		}
+	}
+
+	refreshToken, user, newRefreshToken, err := a.rotateRefreshToken(r, token, clientID)
+	if errors.Is(err, errUnknownRefreshToken) || errors.Is(err, errRefreshTokenReused) ||
+		errors.Is(err, errRefreshTokenRevoked) || errors.Is(err, errRefreshTokenExpired) ||
+		errors.Is(err, errAccountSuspended) {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidGrant, "%v", err))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if scopes == nil {
+		scopes = strings.Fields(refreshToken.Scope)
+	}
+	a.respondWithClientTokens(w, user, client, refreshToken.FamilyID, scopes, newRefreshToken.Token)
+}
+
+// respondWithClientTokens issues an access token restricted to scope, which
+// is never empty: a client token without scope would be unrestricted.
+// sessionID is the grant's refresh token family.
+func (a *apiConfig) respondWithClientTokens(w http.ResponseWriter, user database.User, client database.OauthClient, sessionID uuid.UUID, scope []string, refreshToken string) {
+	if len(scope) == 0 {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidScope, "No scope was granted"))
+		return
+	}
+	accessToken, err := auth.MakeJWT(auth.AccessToken{
+		UserID: user.ID,
+		Version: user.TokenVersion,
+		Scope: scope,
+		ClientID: client.ID,
+		SessionID: sessionID,
+	}, a.jwtKeys, a.tokenConfig)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType string `json:"token_type"`
+		ExpiresIn int `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope string `json:"scope"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: accessToken,
+		TokenType: "Bearer",
+		ExpiresIn: int(a.tokenConfig.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope: strings.Join(scope, " "),
+	})
+}
+
+// oauthRevoke is the revocation endpoint of RFC 7009. Revoking a refresh
+// token revokes every token of its grant. Unknown tokens are not an error, so
+// the answer doesn't tell which tokens exist.
+func (a *apiConfig) oauthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidRequest, "%v", err))
+		return
+	}
+	client, oauthErr := a.authenticateClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidRequest, "token is required"))
+		return
+	}
+	if strings.Count(token, ".") == 2 {
+		respondWithOAuthError(w, http.StatusBadRequest,
+			oauth.Errorf(oauth.ErrUnsupportedTokenType, "Access tokens can't be revoked, they expire on their own"))
+		return
+	}
+
+	selector, verifier, err := auth.ParseRefreshToken(token)
+	if err == nil {
+		refreshToken, err := a.dbQueries.GetRefreshToken(r.Context(), selector)
+		if err == nil && auth.CheckVerifier(verifier, refreshToken.TokenHash) && refreshToken.ClientID.String == client.ID {
+			if _, err := a.dbQueries.RevokeRefreshTokenFamily(r.Context(), refreshToken.FamilyID); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			a.audit(r, auditEvent{
+				Event: auditTokenRevoked,
+				UserID: refreshToken.UserID,
+				Metadata: map[string]any{"session_id": refreshToken.FamilyID, "client_id": client.ID},
+			})
+			log.Printf("OAuth client %s revoked token family %v", client.ID, refreshToken.FamilyID)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// oauthIntrospect is the introspection endpoint of RFC 7662. Clients can
+// only introspect tokens issued to them; any other token is inactive.
+func (a *apiConfig) oauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauth.Errorf(oauth.ErrInvalidRequest, "%v", err))
+		return
+	}
+	client, oauthErr := a.authenticateClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, oauthErr)
+		return
+	}
+
+	type introspection struct {
+		Active bool `json:"active"`
+		Scope string `json:"scope,omitempty"`
+		ClientId string `json:"client_id,omitempty"`
+		Sub string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		Exp int64 `json:"exp,omitempty"`
+		Iat int64 `json:"iat,omitempty"`
+		Iss string `json:"iss,omitempty"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	token := r.PostFormValue("token")
+	if strings.HasPrefix(token, auth.RefreshTokenPrefix) {
+		selector, verifier, err := auth.ParseRefreshToken(token)
+		if err != nil {
+			respondWithJSON(w, http.StatusOK, introspection{})
+			return
+		}
+		refreshToken, err := a.dbQueries.GetRefreshToken(r.Context(), selector)
+		if err != nil || !auth.CheckVerifier(verifier, refreshToken.TokenHash) || refreshToken.ClientID.String != client.ID ||
+			refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now().UTC()) {
+			respondWithJSON(w, http.StatusOK, introspection{})
+			return
+		}
+		user, err := a.dbQueries.GetUserByID(r.Context(), refreshToken.UserID)
+		if err != nil || isSuspended(user) {
+			respondWithJSON(w, http.StatusOK, introspection{})
+			return
+		}
+		respondWithJSON(w, http.StatusOK, introspection{
+			Active: true,
+			Scope: refreshToken.Scope,
+			ClientId: client.ID,
+			Sub: refreshToken.UserID.String(),
+			TokenType: "refresh_token",
+			Exp: refreshToken.ExpiresAt.Unix(),
+			Iat: refreshToken.CreatedAt.Unix(),
+			Iss: a.tokenConfig.Issuer,
+		})
+		return
+	}
+
+	var user database.User
+	accessToken, err := auth.ValidateJWT(token, a.jwtKeys, a.tokenConfig, func(userID uuid.UUID) (int32, error) {
+		var err error
+		user, err = a.dbQueries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return 0, err
+		}
+		return user.TokenVersion, nil
+	})
+	if err == nil && accessToken.SessionID != uuid.Nil {
+		err = a.checkSession(r.Context(), accessToken.SessionID)
+	}
+	if err != nil || accessToken.ClientID != client.ID || isSuspended(user) {
+		respondWithJSON(w, http.StatusOK, introspection{})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, introspection{
+		Active: true,
+		Scope: strings.Join(accessToken.Scope, " "),
+		ClientId: client.ID,
+		Sub: accessToken.UserID.String(),
+		TokenType: "Bearer",
+		Exp: accessToken.ExpiresAt.Unix(),
+		Iat: accessToken.IssuedAt.Unix(),
+		Iss: a.tokenConfig.Issuer,
+	})
+}
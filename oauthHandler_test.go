@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+const (
+	testRedirectURI = "https://cookbook.example.com/callback"
+	// testCodeVerifier is the PKCE code verifier of RFC 7636 appendix B.
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+type testClient struct {
+	ClientId string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type testTokens struct {
+	AccessToken string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope string `json:"scope"`
+}
+
+// registerClient registers a confidential client as the user logged in with
+// token.
+func (s *testServer) registerClient(token, name string, scopes []string) (testClient, error) {
+	client := testClient{}
+	w := s.request("POST", "/api/oauth/clients", token, map[string]any{
+		"name": name,
+		"redirect_uris": []string{testRedirectURI},
+		"scopes": scopes,
+	})
+	if w.Code != http.StatusCreated {
+		return client, fmt.Errorf("couldn't register %s: %d %s", name, w.Code, w.Body.String())
+	}
+	return client, json.Unmarshal(w.Body.Bytes(), &client)
+}
+
+// clientRequest calls the token, revocation or introspection endpoint as
+// client.
+func (s *testServer) clientRequest(path string, client testClient, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(url.QueryEscape(client.ClientId), url.QueryEscape(client.ClientSecret))
+	return s.serve(r)
+}
+
+// authorizeClient approves client for scope as the user logged in with
+// token, with testCodeVerifier for PKCE, and returns the authorization code.
+func (s *testServer) authorizeClient(token string, client testClient, scope string) (string, error) {
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+	w := s.request("POST", "/api/oauth/authorize", token, map[string]any{
+		"response_type": "code",
+		"client_id": client.ClientId,
+		"redirect_uri": testRedirectURI,
+		"scope": scope,
+		"state": "pinkman",
+		"code_challenge": base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+		"approve": true,
+	})
+	if w.Code != http.StatusOK {
+		return "", fmt.Errorf("couldn't authorize: %d %s", w.Code, w.Body.String())
+	}
+	redirect := struct {
+		RedirectTo string `json:"redirect_to"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &redirect); err != nil {
+		return "", err
+	}
+	redirectTo, err := url.Parse(redirect.RedirectTo)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(redirect.RedirectTo, testRedirectURI) || redirectTo.Query().Get("state") != "pinkman" {
+		return "", fmt.Errorf("unexpected redirect %s", redirect.RedirectTo)
+	}
+	return redirectTo.Query().Get("code"), nil
+}
+
+func (s *testServer) exchangeCode(client testClient, code, verifier string) *httptest.ResponseRecorder {
+	return s.clientRequest("/oauth/token", client, url.Values{
+		"grant_type": {"authorization_code"},
+		"code": {code},
+		"redirect_uri": {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+// grantClient runs the whole authorization code flow for client.
+func (s *testServer) grantClient(token string, client testClient, scope string) (testTokens, error) {
+	tokens := testTokens{}
+	code, err := s.authorizeClient(token, client, scope)
+	if err != nil {
+		return tokens, err
+	}
+	w := s.exchangeCode(client, code, testCodeVerifier)
+	if w.Code != http.StatusOK {
+		return tokens, fmt.Errorf("couldn't exchange the code: %d %s", w.Code, w.Body.String())
+	}
+	return tokens, json.Unmarshal(w.Body.Bytes(), &tokens)
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	client, err := s.registerClient(walt.Token, "Cook Book", []string{auth.ScopeChirpsRead, auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	code, err := s.authorizeClient(walt.Token, client, auth.ScopeProfileRead)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	if w := s.exchangeCode(client, code, strings.Repeat("x", 43)); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_grant") {
+		t.Errorf("expected the wrong code_verifier to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	w := s.exchangeCode(client, code, testCodeVerifier)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the code to be exchanged, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	tokens := testTokens{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Errorf("couldn't decode the tokens: %v", err)
+		return
+	}
+	if tokens.Scope != auth.ScopeProfileRead {
+		t.Errorf("expected scope %s, got %q", auth.ScopeProfileRead, tokens.Scope)
+		return
+	}
+	if w := s.request("GET", "/api/warnings", tokens.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the access token to work, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("POST", "/api/chirps", tokens.AccessToken, map[string]string{"body": "Say my name"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected a scope that wasn't granted to be refused, got %d", w.Code)
+		return
+	}
+
+	// A replayed code was intercepted: the tokens it got are revoked.
+	if w := s.exchangeCode(client, code, testCodeVerifier); w.Code != http.StatusBadRequest {
+		t.Errorf("expected the replayed code to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("GET", "/api/warnings", tokens.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the access token to be revoked after a replay, got %d", w.Code)
+		return
+	}
+	w = s.clientRequest("/oauth/token", client, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected the refresh token to be revoked after a replay, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOAuthRefreshIsBoundToClient(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	cookBook, err := s.registerClient(walt.Token, "Cook Book", []string{auth.ScopeChirpsRead, auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	carWash, err := s.registerClient(walt.Token, "Car Wash", []string{auth.ScopeChirpsRead, auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	tokens, err := s.grantClient(walt.Token, cookBook, auth.ScopeChirpsRead + " " + auth.ScopeProfileRead)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	if w := s.clientRequest("/oauth/token", carWash, refresh); w.Code != http.StatusBadRequest {
+		t.Errorf("expected another client's refresh token to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	refresh.Set("scope", auth.ScopeProfileRead)
+	w := s.clientRequest("/oauth/token", cookBook, refresh)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the client to refresh its own token, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	refreshed := testTokens{}
+	if err := json.Unmarshal(w.Body.Bytes(), &refreshed); err != nil {
+		t.Errorf("couldn't decode the tokens: %v", err)
+		return
+	}
+	if refreshed.Scope != auth.ScopeProfileRead || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("expected a rotated token with the narrower scope, got %+v", refreshed)
+	}
+}
+
+func TestOAuthRevokeAndIntrospect(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	cookBook, err := s.registerClient(walt.Token, "Cook Book", []string{auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	carWash, err := s.registerClient(walt.Token, "Car Wash", []string{auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	tokens, err := s.grantClient(walt.Token, cookBook, auth.ScopeProfileRead)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	active := func(client testClient, token string) (bool, error) {
+		w := s.clientRequest("/oauth/introspect", client, url.Values{"token": {token}})
+		if w.Code != http.StatusOK {
+			return false, fmt.Errorf("couldn't introspect: %d %s", w.Code, w.Body.String())
+		}
+		introspection := struct {
+			Active bool `json:"active"`
+			ClientId string `json:"client_id"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &introspection); err != nil {
+			return false, err
+		}
+		return introspection.Active && introspection.ClientId == client.ClientId, nil
+	}
+
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if ok, err := active(cookBook, token); err != nil || !ok {
+			t.Errorf("expected the token to be active for its client (%v)", err)
+			return
+		}
+		if ok, err := active(carWash, token); err != nil || ok {
+			t.Errorf("expected the token to be inactive for another client (%v)", err)
+			return
+		}
+	}
+
+	// Another client can't revoke it; the answer doesn't tell.
+	if w := s.clientRequest("/oauth/revoke", carWash, url.Values{"token": {tokens.RefreshToken}}); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if ok, err := active(cookBook, tokens.RefreshToken); err != nil || !ok {
+		t.Errorf("another client revoked the token (%v)", err)
+		return
+	}
+
+	if w := s.clientRequest("/oauth/revoke", cookBook, url.Values{"token": {tokens.RefreshToken}}); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if ok, err := active(cookBook, token); err != nil || ok {
+			t.Errorf("expected the grant's tokens to be inactive once revoked (%v)", err)
+			return
+		}
+	}
+	if w := s.request("GET", "/api/warnings", tokens.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked grant's access token to be refused, got %d", w.Code)
+	}
+}
+
+func TestDeletedOAuthClientTokensAreRefused(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	client, err := s.registerClient(walt.Token, "Cook Book", []string{auth.ScopeProfileRead})
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	tokens, err := s.grantClient(walt.Token, client, auth.ScopeProfileRead)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	if w := s.request("DELETE", "/api/oauth/clients/" + client.ClientId, walt.Token, nil); w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("GET", "/api/warnings", tokens.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the deleted client's access token to be refused, got %d", w.Code)
+	}
+}
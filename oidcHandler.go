@@ -0,0 +1,247 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/NHMosko/chirpy/internal/oidc"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// oidcLoginTTL is how long the user has to sign in at the provider.
+const oidcLoginTTL = 10 * time.Minute
+
+var errUnverifiedIdentity = errors.New("The provider hasn't verified this email address")
+
+// beginOIDCLogin starts a login with the OpenID Connect provider and sends
+// back where to send the user to sign in there.
+func (a *apiConfig) beginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if a.oidc == nil {
+		respondWithError(w, http.StatusNotFound, "Login with an identity provider isn't set up")
+		return
+	}
+	if err := a.dbQueries.DeleteExpiredOIDCLogins(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	login, err := oidc.NewLogin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	browserHash, err := a.bindBrowser(w, r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = a.dbQueries.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		ID: login.State,
+		Nonce: login.Nonce,
+		CodeVerifier: login.CodeVerifier,
+		BrowserHash: browserHash,
+		ExpiresAt: time.Now().UTC().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type beginResponse struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	respondWithJSON(w, http.StatusOK, beginResponse{AuthorizationURL: a.oidc.AuthCodeURL(login)})
+}
+
+// finishOIDCLogin takes the code and state the provider sent the user back
+// with and signs them in like a password login, linking the provider's
+// account to a user first if needed.
+func (a *apiConfig) finishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if a.oidc == nil {
+		respondWithError(w, http.StatusNotFound, "Login with an identity provider isn't set up")
+		return
+	}
+	type finishInput struct {
+		Code string `json:"code"`
+		State string `json:"state"`
+	}
+	input := finishInput{}
+	decodeInput(w, r, &input)
+
+	login, err := a.dbQueries.TakeOIDCLogin(r.Context(), input.State)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "This login has expired or was already used, please start again")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !browserMatches(r, login.BrowserHash) {
+		log.Printf("Refused an identity provider login finished in another browser")
+		respondWithError(w, http.StatusBadRequest, "This login was started in another browser, please start again")
+		return
+	}
+
+	idToken, err := a.oidc.Exchange(r.Context(), input.Code, login.CodeVerifier)
+	if err != nil {
+		log.Printf("Failed identity provider log in attempt: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Login with the identity provider failed")
+		return
+	}
+	identity, err := a.oidc.VerifyIDToken(r.Context(), idToken, login.Nonce)
+	if err != nil {
+		log.Printf("Refused an ID token: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Login with the identity provider failed")
+		return
+	}
+
+	user, err := a.linkIdentity(r, identity)
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		respondWithValidationError(w, err)
+		return
+	}
+	if errors.Is(err, errUnverifiedIdentity) {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if isSuspended(user) {
+		log.Printf("Suspended user tried to log in")
+		respondSuspended(w, user)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		log.Printf("Identity provider login accepted, waiting for the second factor")
+		a.respondMFARequired(w, user)
+		return
+	}
+	a.issueSession(w, r, user, "oidc")
+}
+
+// linkIdentity finds the user an identity signs in as. An identity seen for
+// the first time is linked to the user with its email, or to a new user,
+// but only when the provider vouches for the address.
+func (a *apiConfig) linkIdentity(r *http.Request, identity oidc.Identity) (database.User, error) {
+	ctx := r.Context()
+	var user database.User
+	takenOver := false
+	err := a.withTx(ctx, func(q *database.Queries) error {
+		linked, err := q.GetUserIdentity(ctx, database.GetUserIdentityParams{
+			Issuer: identity.Issuer,
+			Subject: identity.Subject,
+		})
+		if err == nil {
+			err = q.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+				Issuer: identity.Issuer,
+				Subject: identity.Subject,
+				Email: identity.Email,
+			})
+			if err != nil {
+				return err
+			}
+			user, err = q.GetUserByID(ctx, linked.UserID)
+			return err
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if !identity.EmailVerified {
+			return errUnverifiedIdentity
+		}
+		email, err := validate.Email(identity.Email)
+		if err != nil {
+			return err
+		}
+		// Nobody knows the password of a linked or new account until they
+		// reset it; they sign in through the provider.
+		unusableHash, err := auth.HashPassword(uuid.NewString(), a.passwordParams)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = q.CreateUser(ctx, database.CreateUserParams{
+				Email: email,
+				HashedPassword: unusableHash,
+			})
+			if err != nil {
+				return err
+			}
+			user, err = q.VerifyEmail(ctx, database.VerifyEmailParams{ID: user.ID, Email: email})
+			if err != nil {
+				return err
+			}
+			log.Printf("New User Created from identity provider %s", identity.Issuer)
+		} else if err != nil {
+			return err
+		} else if !user.EmailVerifiedAt.Valid {
+			// Whoever signed up with this address never proved it was
+			// theirs: they may have set up the account ahead of its owner
+			// to get into it later. The owner takes it over and every way
+			// in it had stops working.
+			if err := wipeCredentials(ctx, q, user.ID, unusableHash); err != nil {
+				return err
+			}
+			user, err = q.VerifyEmail(ctx, database.VerifyEmailParams{ID: user.ID, Email: email})
+			if err != nil {
+				return err
+			}
+			err = a.appendAudit(q, r, auditEvent{
+				Event: auditIdentityTakeover,
+				ActorID: user.ID,
+				UserID: user.ID,
+				Metadata: map[string]any{"issuer": identity.Issuer},
+			})
+			if err != nil {
+				return err
+			}
+			takenOver = true
+			log.Printf("User %v taken over by its verified owner from identity provider %s", user.ID, identity.Issuer)
+		}
+
+		log.Printf("Linked user %v to an identity from %s", user.ID, identity.Issuer)
+		err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			Issuer: identity.Issuer,
+			Subject: identity.Subject,
+			UserID: user.ID,
+			Email: email,
+		})
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{
+			Event: auditIdentityLinked,
+			ActorID: user.ID,
+			UserID: user.ID,
+			Metadata: map[string]any{"issuer": identity.Issuer},
+		})
+	})
+	if err == nil && takenOver {
+		a.sendMail(r, mailer.Message{
+			To: user.Email,
+			Subject: "Your Chirpy account was secured",
+			Body: "You signed in to Chirpy through your identity provider with this address. " +
+				"A Chirpy account had been created with it, but the address was never verified, " +
+				"so it may not have been you who created it.\n\n" +
+				"To keep whoever did out, the account was logged out everywhere and its password, " +
+				"two-factor authentication, passkeys, personal access tokens and linked sign-ins were removed. " +
+				"If you did create it, choose a new password with \"Forgot password\" on the login page.\n",
+		})
+	}
+	return user, err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/oidc"
+	"github.com/NHMosko/chirpy/internal/oidc/oidctest"
+)
+
+// useMockProvider lets users of s log in with a mock provider, signing in
+// walt@breakingbad.com. The caller closes the server.
+func (s *testServer) useMockProvider() (*httptest.Server, error) {
+	server := httptest.NewUnstartedServer(nil)
+	issuer := "http://" + server.Listener.Addr().String()
+	mock, err := oidctest.New(issuer, "chirpy", "s3cret")
+	if err != nil {
+		return nil, err
+	}
+	server.Config.Handler = mock
+	server.Start()
+
+	s.api.oidc, err = oidc.Discover(context.Background(), oidc.Config{
+		Issuer: issuer,
+		ClientID: "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURI: "http://localhost:8080/app/login/oidc",
+	}, server.Client())
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+// oidcLogin logs in through the provider like a browser would, finishing
+// the login in the browser that started it unless otherBrowser is set.
+func (s *testServer) oidcLogin(otherBrowser bool) (*httptest.ResponseRecorder, error) {
+	w := s.request("POST", "/api/login/oidc/begin", "", nil)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("couldn't begin the login: %d %s", w.Code, w.Body.String())
+	}
+	begin := struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &begin); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(begin.AuthorizationURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("expected a redirect from the provider, got %s", resp.Status)
+	}
+
+	r := newTestRequest("POST", "/api/login/oidc/finish", "", map[string]string{
+		"code": location.Query().Get("code"),
+		"state": location.Query().Get("state"),
+	})
+	if !otherBrowser {
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+	}
+	return s.serve(r), nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+	provider, err := s.useMockProvider()
+	if err != nil {
+		t.Errorf("couldn't start the provider: %v", err)
+		return
+	}
+	defer provider.Close()
+
+	w, err := s.oidcLogin(false)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a new account to be signed in, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	first := testLogin{}
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Errorf("couldn't decode the login: %v", err)
+		return
+	}
+
+	w, err = s.oidcLogin(false)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the linked account to be signed in, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	again := testLogin{}
+	if err := json.Unmarshal(w.Body.Bytes(), &again); err != nil {
+		t.Errorf("couldn't decode the login: %v", err)
+		return
+	}
+	if again.Id != first.Id {
+		t.Errorf("expected the identity to sign in as %v again, got %v", first.Id, again.Id)
+		return
+	}
+	if sent := s.mailed("walt@breakingbad.com", "Your Chirpy account was secured"); sent != 0 {
+		t.Errorf("no account was taken over, but %d notices were sent", sent)
+		return
+	}
+
+	w, err = s.oidcLogin(true)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a login finished in another browser to be refused, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCLoginTakesOverUnverifiedAccount(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+	provider, err := s.useMockProvider()
+	if err != nil {
+		t.Errorf("couldn't start the provider: %v", err)
+		return
+	}
+	defer provider.Close()
+
+	// Someone who doesn't own the address signs up with it first.
+	squatter, err := s.signUp("walt@breakingbad.com", "tread lightly my friend", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	w := s.request("POST", "/api/tokens", squatter.Token, map[string]any{"name": "backdoor", "scopes": []string{auth.ScopeProfileRead}})
+	if w.Code != http.StatusCreated {
+		t.Errorf("couldn't create a token: %d %s", w.Code, w.Body.String())
+		return
+	}
+	pat := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &pat); err != nil {
+		t.Errorf("couldn't decode the token: %v", err)
+		return
+	}
+
+	w, err = s.oidcLogin(false)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the owner to be signed in, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	owner := testLogin{}
+	if err := json.Unmarshal(w.Body.Bytes(), &owner); err != nil {
+		t.Errorf("couldn't decode the login: %v", err)
+		return
+	}
+	if owner.Id != squatter.Id {
+		t.Errorf("expected the owner to take over account %v, got %v", squatter.Id, owner.Id)
+		return
+	}
+
+	if w := s.request("GET", "/api/sessions", squatter.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the earlier session to be logged out, got %d", w.Code)
+		return
+	}
+	if w := s.request("GET", "/api/warnings", pat.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the earlier personal access token to be revoked, got %d", w.Code)
+		return
+	}
+	if _, err := s.login("walt@breakingbad.com", "tread lightly my friend"); err == nil {
+		t.Errorf("the earlier password still works")
+		return
+	}
+
+	if sent := s.mailed("walt@breakingbad.com", "Your Chirpy account was secured"); sent != 1 {
+		t.Errorf("expected one takeover notice, got %d", sent)
+		return
+	}
+	events, err := s.api.dbQueries.ListAuditEvents(context.Background(), database.ListAuditEventsParams{
+		Event: sql.NullString{String: auditIdentityTakeover, Valid: true},
+		MaxResults: 10,
+	})
+	if err != nil {
+		t.Errorf("couldn't list audit events: %v", err)
+		return
+	}
+	if len(events) != 1 || events[0].UserID.UUID != owner.Id {
+		t.Errorf("expected one takeover event for %v, got %+v", owner.Id, events)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// backgroundTimeout bounds work done after the response is written,
+	// such as sending an email.
+	backgroundTimeout = 30 * time.Second
+)
+
+// inBackground runs fn after the response is written, with a context that
+// outlives the request, so the response neither waits on the work nor tells
+// by its timing whether there was any. Errors are only logged, with what
+// describing the work. Wait on a.background for it to finish.
+func (a *apiConfig) inBackground(r *http.Request, what string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundTimeout)
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("Couldn't %s: %v", what, err)
+		}
+	}()
+}
+
+// sendMail delivers msg in the background so the response doesn't wait on
+// the mail server, nor tell by its timing whether anything was sent.
+func (a *apiConfig) sendMail(r *http.Request, msg mailer.Message) {
+	a.inBackground(r, fmt.Sprintf("send %q", msg.Subject), func(ctx context.Context) error {
+		return a.mailer.Send(ctx, msg)
+	})
+}
+
+// startPasswordReset mails user a one-time reset token, waiting for the mail
+// server. forced says an admin already replaced the password, rather than
+// someone asking to reset it.
+func (a *apiConfig) startPasswordReset(ctx context.Context, user database.User, forced bool) error {
+	reset, err := auth.MakePasswordResetToken()
+	if err != nil {
+		return err
+	}
+	// Only the latest token works.
+	err = a.withTx(ctx, func(q *database.Queries) error {
+		if err := q.DeletePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		return q.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			ID: reset.Selector,
+			TokenHash: reset.VerifierHash,
+			UserID: user.ID,
+			ExpiresAt: time.Now().UTC().Add(passwordResetTTL),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	intro := "Someone asked to reset the password of your Chirpy account."
+	outro := "If it wasn't you, ignore this email and your password stays the same."
+	if forced {
+		intro = "A Chirpy admin reset the password of your account, removed its two-factor authentication, " +
+			"passkeys, personal access tokens and linked sign-ins, and logged you out everywhere."
+		outro = "Once it expires, ask for a new one on the login page."
+	}
+	return a.mailer.Send(ctx, mailer.Message{
+		To: user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("%s\n\n" +
+			"Use this token to choose a new password, it expires in %v:\n\n%s\n\n%s\n",
+			intro, passwordResetTTL, reset.Token, outro),
+	})
+}
+
+// requestPasswordReset emails a one-time reset token. Looking the email up
+// and sending the token happen in the background, so the answer is the same,
+// and as fast, whether or not the email belongs to an account: it can't be
+// used to find out who has one.
+func (a *apiConfig) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type resetInput struct {
+		Email string `json:"email"`
+	}
+	input := resetInput{}
+	decodeInput(w, r, &input)
+
+	a.inBackground(r, "start a password reset", func(ctx context.Context) error {
+		user, err := a.dbQueries.GetUserByEmail(ctx, input.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := a.startPasswordReset(ctx, user, false); err != nil {
+			return err
+		}
+		log.Printf("Password reset requested for user %v", user.ID)
+		return nil
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// confirmPasswordReset sets the new password and logs the user out
+// everywhere: whoever made them reset it may be holding a session.
+func (a *apiConfig) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type confirmInput struct {
+		Token string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	input := confirmInput{}
+	decodeInput(w, r, &input)
+
+	selector, verifier, err := auth.ParsePasswordResetToken(input.Token)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var userID uuid.UUID
+	var fieldErrs validate.Errors
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		reset, err := q.GetPasswordResetTokenForUpdate(r.Context(), selector)
+		if err != nil {
+			return err
+		}
+		if !auth.CheckVerifier(verifier, reset.TokenHash) || time.Now().UTC().After(reset.ExpiresAt) {
+			return sql.ErrNoRows
+		}
+		userID = reset.UserID
+
+		// The email is only known once the token is, so the policy is
+		// checked here. The token stays valid for another try.
+		user, err := q.GetUserByID(r.Context(), reset.UserID)
+		if err != nil {
+			return err
+		}
+		if err := a.passwordPolicy.Password(input.NewPassword, user.Email); err != nil {
+			return err
+		}
+		passwd, err := auth.HashPassword(input.NewPassword, a.passwordParams)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+			ID: reset.UserID,
+			HashedPassword: passwd,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.DeletePasswordResetTokens(r.Context(), reset.UserID); err != nil {
+			return err
+		}
+		if _, err := logOutEverywhere(r.Context(), q, reset.UserID); err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{Event: auditPasswordReset, ActorID: reset.UserID, UserID: reset.UserID})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "This reset token is invalid or has expired")
+		return
+	}
+	if errors.As(err, &fieldErrs) {
+		for i := range fieldErrs {
+			fieldErrs[i].Field = "new_password"
+		}
+		respondWithValidationError(w, fieldErrs)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("User %v reset their password", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+)
+
+func TestPasswordResetFlow(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	unknown := s.request("POST", "/api/password-reset/request", "", map[string]string{"email": "jesse@breakingbad.com"})
+	known := s.request("POST", "/api/password-reset/request", "", map[string]string{"email": "walt@breakingbad.com"})
+	if unknown.Code != http.StatusAccepted || known.Code != http.StatusAccepted || unknown.Body.String() != known.Body.String() {
+		t.Errorf("expected the same 202 for both emails, got %d %q and %d %q",
+			unknown.Code, unknown.Body.String(), known.Code, known.Body.String())
+		return
+	}
+	if token := s.mailedToken("jesse@breakingbad.com", auth.PasswordResetTokenPrefix); token != "" {
+		t.Errorf("an email without an account shouldn't get a reset token")
+		return
+	}
+	token := s.mailedToken("walt@breakingbad.com", auth.PasswordResetTokenPrefix)
+	if token == "" {
+		t.Errorf("expected a reset token to be mailed")
+		return
+	}
+
+	w := s.request("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "new_password": "i am the one who knocks"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	w = s.request("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "new_password": "tread lightly my friend"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a used token to be refused, got %d", w.Code)
+		return
+	}
+
+	if w := s.request("GET", "/api/sessions", walt.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the old access token to be refused, got %d", w.Code)
+		return
+	}
+	if _, err := s.login("walt@breakingbad.com", "say my name heisenberg"); err == nil {
+		t.Errorf("the old password still works")
+		return
+	}
+	if _, err := s.login("walt@breakingbad.com", "i am the one who knocks"); err != nil {
+		t.Errorf("the new password doesn't work: %v", err)
+	}
+}
+
+func TestPasswordResetRevokesPersonalAccessTokens(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	w := s.request("POST", "/api/tokens", walt.Token, map[string]any{"name": "cook bot", "scopes": []string{auth.ScopeProfileRead}})
+	if w.Code != http.StatusCreated {
+		t.Errorf("couldn't create a token: %d %s", w.Code, w.Body.String())
+		return
+	}
+	pat := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &pat); err != nil {
+		t.Errorf("couldn't decode the token: %v", err)
+		return
+	}
+	if w := s.request("GET", "/api/warnings", pat.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("expected the token to work, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	s.request("POST", "/api/password-reset/request", "", map[string]string{"email": "walt@breakingbad.com"})
+	token := s.mailedToken("walt@breakingbad.com", auth.PasswordResetTokenPrefix)
+	w = s.request("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "new_password": "i am the one who knocks"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	if w := s.request("GET", "/api/warnings", pat.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the personal access token to be refused after a reset, got %d", w.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/validate"
+)
+
+const (
+	maxTokenNameLength = 100
+	// tokenTouchInterval is how stale last_used_at may get before a request
+	// updates it, so busy scripts don't write on every call.
+	tokenTouchInterval = time.Minute
+)
+
+type personalTokenResponse struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Scopes []string `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// Token is only sent when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func toPersonalTokenResponse(pat database.PersonalAccessToken) personalTokenResponse {
+	tokenData := personalTokenResponse{
+		Id: pat.ID,
+		Name: pat.Name,
+		Scopes: strings.Fields(pat.Scope),
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		tokenData.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		tokenData.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return tokenData
+}
+
+// checkPersonalAccessToken looks a personal access token up and checks it
+// hasn't expired, noting when it was last used.
+func (a *apiConfig) checkPersonalAccessToken(ctx context.Context, token string) (database.PersonalAccessToken, error) {
+	selector, verifier, err := auth.ParsePersonalAccessToken(token)
+	if err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	pat, err := a.dbQueries.GetPersonalAccessToken(ctx, selector)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return database.PersonalAccessToken{}, err
+	}
+	now := time.Now().UTC()
+	if err != nil || !auth.CheckVerifier(verifier, pat.TokenHash) || (pat.ExpiresAt.Valid && now.After(pat.ExpiresAt.Time)) {
+		return database.PersonalAccessToken{}, fmt.Errorf("Personal access token is invalid or has expired")
+	}
+
+	if !pat.LastUsedAt.Valid || now.Sub(pat.LastUsedAt.Time) >= tokenTouchInterval {
+		err := a.dbQueries.TouchPersonalAccessToken(ctx, database.TouchPersonalAccessTokenParams{
+			ID: pat.ID,
+			LastUsedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			log.Printf("Couldn't note use of personal access token %s: %v", pat.ID, err)
+		}
+	}
+	return pat, nil
+}
+
+// createPersonalAccessToken issues a long-lived token for scripts and bots.
+// The token is only ever shown in this response.
+func (a *apiConfig) createPersonalAccessToken(w http.ResponseWriter, r *http.Request, user database.User) {
+	type tokenInput struct {
+		Name string `json:"name"`
+		Scopes []string `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	input := tokenInput{}
+	decodeInput(w, r, &input)
+
+	var errs validate.Errors
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		errs.Add("name", "empty", "Name can't be empty")
+	} else if len(input.Name) > maxTokenNameLength {
+		errs.Add("name", "too_long", fmt.Sprintf("Name can't be longer than %d characters", maxTokenNameLength))
+	}
+
+	scopes, err := auth.ParseScopes(input.Scopes)
+	if err != nil {
+		errs.Add("scopes", "invalid", err.Error())
+	} else if len(scopes) == 0 {
+		errs.Add("scopes", "empty", "A token needs at least one scope")
+	}
+
+	var expiresAt sql.NullTime
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			errs.Add("expires_at", "in_past", "Expiry must be in the future")
+		}
+		expiresAt = sql.NullTime{Time: input.ExpiresAt.UTC(), Valid: true}
+	}
+
+	if err := errs.Err(); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pat, err := a.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID: token.Selector,
+		TokenHash: token.VerifierHash,
+		UserID: user.ID,
+		Name: input.Name,
+		Scope: strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditPersonalTokenCreated,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"token_id": pat.ID, "name": pat.Name, "scope": pat.Scope},
+	})
+	log.Printf("User %v created personal access token %s", user.ID, pat.ID)
+	tokenData := toPersonalTokenResponse(pat)
+	tokenData.Token = token.Token
+	respondWithJSON(w, http.StatusCreated, tokenData)
+}
+
+func (a *apiConfig) listPersonalAccessTokens(w http.ResponseWriter, r *http.Request, user database.User) {
+	tokens, err := a.dbQueries.ListPersonalAccessTokens(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tokensData := []personalTokenResponse{}
+	for _, pat := range tokens {
+		tokensData = append(tokensData, toPersonalTokenResponse(pat))
+	}
+	respondWithJSON(w, http.StatusOK, tokensData)
+}
+
+func (a *apiConfig) deletePersonalAccessToken(w http.ResponseWriter, r *http.Request, user database.User) {
+	tokenID := r.PathValue("tokenID")
+	deleted, err := a.dbQueries.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID: tokenID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find a personal access token with that id")
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditPersonalTokenDeleted,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"token_id": tokenID},
+	})
+	log.Printf("User %v deleted personal access token %s", user.ID, tokenID)
+	w.WriteHeader(http.StatusNoContent)
+}
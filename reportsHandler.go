@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+	"github.com/rivo/uniseg"
+)
+
+var reportReasons = []string{
+	"spam",
+	"harassment",
+	"hate",
+	"violence",
+	"self_harm",
+	"misinformation",
+	"impersonation",
+	"other",
+}
+
+const (
+	reportOpen = "open"
+	reportResolved = "resolved"
+	reportDismissed = "dismissed"
+)
+
+// Moderator actions, as recorded in the moderation log.
+const (
+	modHideChirp = "hide_chirp"
+	modUnhideChirp = "unhide_chirp"
+	modSuspendUser = "suspend_user"
+	modUnsuspendUser = "unsuspend_user"
+	modWarnUser = "warn_user"
+	modShadowBanUser = "shadow_ban_user"
+	modUnshadowBanUser = "unshadow_ban_user"
+	modResolveReport = "resolve_report"
+	modDismissReport = "dismiss_report"
+)
+
+type reportResponse struct {
+	Id uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ReporterId uuid.UUID `json:"reporter_id"`
+	ReportedUserId uuid.UUID `json:"reported_user_id"`
+	ChirpId *uuid.UUID `json:"chirp_id"`
+	Reason string `json:"reason"`
+	Details string `json:"details"`
+	Status string `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+func convertReport(report database.Report) reportResponse {
+	reportData := reportResponse{
+		Id: report.ID,
+		CreatedAt: report.CreatedAt,
+		UpdatedAt: report.UpdatedAt,
+		ReporterId: report.ReporterID,
+		ReportedUserId: report.ReportedUserID,
+		Reason: report.Reason,
+		Details: report.Details,
+		Status: report.Status,
+	}
+	if report.ChirpID.Valid {
+		reportData.ChirpId = &report.ChirpID.UUID
+	}
+	if report.ResolvedAt.Valid {
+		reportData.ResolvedAt = &report.ResolvedAt.Time
+	}
+	return reportData
+}
+
+func (a *apiConfig) reportChirp(w http.ResponseWriter, r *http.Request, user database.User) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Only chirps the reporter can see, like getChirpByID, so the answer
+	// doesn't give away which chirps were hidden or whose authors were
+	// shadow banned.
+	chirp, err := a.dbQueries.GetVisibleChirp(r.Context(), database.GetVisibleChirpParams{
+		ID: chirpID,
+		ViewerID: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find chirp on database")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a.createReport(w, r, user, chirp.UserID, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+}
+
+func (a *apiConfig) reportUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reported, err := a.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user on database")
+		return
+	}
+
+	a.createReport(w, r, user, reported.ID, uuid.NullUUID{})
+}
+
+func (a *apiConfig) createReport(w http.ResponseWriter, r *http.Request, user database.User, reportedUserID uuid.UUID, chirpID uuid.NullUUID) {
+	reporterID := user.ID
+
+	type reportInput struct {
+		Reason string `json:"reason"`
+		Details string `json:"details"`
+	}
+	input := reportInput{}
+	decodeInput(w, r, &input)
+
+	if err := checkReport(reporterID, reportedUserID, input.Reason, input.Details); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	report, err := a.dbQueries.CreateReport(r.Context(), database.CreateReportParams{
+		ReporterID: reporterID,
+		ReportedUserID: reportedUserID,
+		ChirpID: chirpID,
+		Reason: input.Reason,
+		Details: input.Details,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("New %s report %v filed", report.Reason, report.ID)
+	respondWithJSON(w, http.StatusCreated, convertReport(report))
+}
+
+const maxReportDetails = 1000
+
+func checkReport(reporterID, reportedUserID uuid.UUID, reason, details string) error {
+	var errs validate.Errors
+	if !slices.Contains(reportReasons, reason) {
+		errs.Add("reason", "invalid", "Reason must be one of the documented reason codes")
+	}
+	if uniseg.GraphemeClusterCount(details) > maxReportDetails {
+		errs.Add("details", "too_long", fmt.Sprintf("Details cannot be longer than %d characters", maxReportDetails))
+	}
+	if reporterID == reportedUserID {
+		errs.Add("target", "self_report", "You can't report yourself")
+	}
+	return errs.Err()
+}
+
+func (a *apiConfig) listReports(w http.ResponseWriter, r *http.Request, user database.User) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+	if status != reportOpen && status != reportResolved && status != reportDismissed {
+		respondWithError(w, http.StatusBadRequest, "Unknown report status")
+		return
+	}
+
+	reports, err := a.dbQueries.ListReportsByStatus(r.Context(), status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reportsData := []reportResponse{}
+	for _, report := range reports {
+		reportsData = append(reportsData, convertReport(report))
+	}
+	respondWithJSON(w, http.StatusOK, reportsData)
+}
+
+// errNoChange is returned by applyModerationAction when the target is already
+// in the state the action would put it in; nothing is logged then.
+var errNoChange = errors.New("nothing to change")
+
+// moderationAction is a single enforcement step taken by a moderator. It is
+// applied and written to the moderation log in the same transaction.
+type moderationAction struct {
+	Kind string
+	ModeratorID uuid.NullUUID
+	UserID uuid.UUID
+	ChirpID uuid.UUID
+	ReportID uuid.NullUUID
+	Until time.Time
+	Message string
+	Note string
+}
+
+func applyModerationAction(ctx context.Context, q *database.Queries, act moderationAction) error {
+	entry := database.AppendModerationLogParams{
+		ModeratorID: act.ModeratorID,
+		Action: act.Kind,
+		ReportID: act.ReportID,
+		Note: act.Note,
+	}
+	if act.UserID != uuid.Nil {
+		entry.TargetUserID = uuid.NullUUID{UUID: act.UserID, Valid: true}
+	}
+	if act.ChirpID != uuid.Nil {
+		entry.TargetChirpID = uuid.NullUUID{UUID: act.ChirpID, Valid: true}
+	}
+
+	changed := int64(1)
+	var err error
+	switch act.Kind {
+	case modHideChirp:
+		changed, err = q.HideChirp(ctx, act.ChirpID)
+	case modUnhideChirp:
+		changed, err = q.UnhideChirp(ctx, act.ChirpID)
+	case modSuspendUser:
+		changed, err = q.SuspendUser(ctx, database.SuspendUserParams{
+			ID: act.UserID,
+			SuspendedUntil: sql.NullTime{Time: act.Until, Valid: true},
+		})
+		if entry.Note == "" {
+			entry.Note = "suspended until " + act.Until.Format(time.RFC3339)
+		}
+	case modUnsuspendUser:
+		changed, err = q.SuspendUser(ctx, database.SuspendUserParams{ID: act.UserID})
+	case modShadowBanUser, modUnshadowBanUser:
+		changed, err = q.SetShadowBanned(ctx, database.SetShadowBannedParams{
+			ID: act.UserID,
+			ShadowBanned: act.Kind == modShadowBanUser,
+		})
+	case modWarnUser:
+		_, err = q.CreateWarning(ctx, database.CreateWarningParams{
+			UserID: act.UserID,
+			ReportID: act.ReportID,
+			Message: act.Message,
+		})
+		if entry.Note == "" {
+			entry.Note = act.Message
+		}
+	case modResolveReport, modDismissReport:
+	default:
+		return errors.New("unknown moderation action " + act.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return errNoChange
+	}
+
+	_, err = q.AppendModerationLog(ctx, entry)
+	return err
+}
+
+// auditModeration records act in the audit log, next to its entry in the
+// moderation log.
+func (a *apiConfig) auditModeration(q *database.Queries, r *http.Request, act moderationAction) error {
+	metadata := map[string]any{}
+	if act.ChirpID != uuid.Nil {
+		metadata["chirp_id"] = act.ChirpID
+	}
+	if act.ReportID.Valid {
+		metadata["report_id"] = act.ReportID.UUID
+	}
+	if !act.Until.IsZero() {
+		metadata["suspended_until"] = act.Until
+	}
+	if act.Note != "" {
+		metadata["note"] = act.Note
+	}
+	return a.appendAudit(q, r, auditEvent{
+		Event: "moderation." + act.Kind,
+		ActorID: act.ModeratorID.UUID,
+		UserID: act.UserID,
+		Metadata: metadata,
+	})
+}
+
+type moderationInput struct {
+	Action string `json:"action"`
+	Note string `json:"note"`
+	Message string `json:"message"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+}
+
+// check validates the fields the chosen action needs. An empty action is
+// allowed when allowNone is set, for resolving a report without enforcement.
+func (in moderationInput) check(allowNone bool) error {
+	var errs validate.Errors
+	switch in.Action {
+	case "":
+		if !allowNone {
+			errs.Add("action", "required", "An action is required")
+		}
+	case modHideChirp, modUnhideChirp, modUnsuspendUser, modShadowBanUser, modUnshadowBanUser:
+	case modSuspendUser:
+		if in.SuspendedUntil == nil || !in.SuspendedUntil.After(time.Now()) {
+			errs.Add("suspended_until", "invalid", "Suspensions need an end date in the future")
+		}
+	case modWarnUser:
+		if in.Message == "" {
+			errs.Add("message", "required", "Warnings need a message for the user")
+		}
+	default:
+		errs.Add("action", "invalid", "Unknown moderation action")
+	}
+	return errs.Err()
+}
+
+func (in moderationInput) action() moderationAction {
+	act := moderationAction{
+		Kind: in.Action,
+		Message: in.Message,
+		Note: in.Note,
+	}
+	if in.SuspendedUntil != nil {
+		act.Until = in.SuspendedUntil.UTC()
+	}
+	return act
+}
+
+func (a *apiConfig) resolveReport(w http.ResponseWriter, r *http.Request, moderator database.User) {
+	a.closeReport(w, r, moderator, reportResolved)
+}
+
+func (a *apiConfig) dismissReport(w http.ResponseWriter, r *http.Request, moderator database.User) {
+	a.closeReport(w, r, moderator, reportDismissed)
+}
+
+func (a *apiConfig) closeReport(w http.ResponseWriter, r *http.Request, moderator database.User, status string) {
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input := moderationInput{}
+	decodeInput(w, r, &input)
+	if status == reportDismissed {
+		input.Action = ""
+	}
+	if err := input.check(true); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+	// Acting on a report is moderating, not only handling reports.
+	if input.Action != "" && !a.checkPermission(w, r, moderator, permContentModerate) {
+		return
+	}
+
+	report, err := a.dbQueries.GetReport(r.Context(), reportID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find report on database")
+		return
+	}
+	if input.Action == modHideChirp || input.Action == modUnhideChirp {
+		if !report.ChirpID.Valid {
+			respondWithError(w, http.StatusBadRequest, "This report isn't about a chirp")
+			return
+		}
+	}
+
+	reportRef := uuid.NullUUID{UUID: report.ID, Valid: true}
+	closeKind := modResolveReport
+	if status == reportDismissed {
+		closeKind = modDismissReport
+	}
+
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		closed, err := q.CloseReport(r.Context(), database.CloseReportParams{
+			ID: report.ID,
+			Status: status,
+		})
+		if err != nil {
+			return err
+		}
+		report = closed
+
+		if input.Action != "" {
+			act := input.action()
+			act.UserID = report.ReportedUserID
+			act.ChirpID = report.ChirpID.UUID
+			act.ReportID = reportRef
+			act.ModeratorID = moderatorID
+			if err := applyModerationAction(r.Context(), q, act); err != nil {
+				return err
+			}
+			if err := a.auditModeration(q, r, act); err != nil {
+				return err
+			}
+		}
+
+		return applyModerationAction(r.Context(), q, moderationAction{
+			Kind: closeKind,
+			ModeratorID: moderatorID,
+			UserID: report.ReportedUserID,
+			ChirpID: report.ChirpID.UUID,
+			ReportID: reportRef,
+			Note: input.Note,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "This report has already been closed")
+		return
+	}
+	if errors.Is(err, errNoChange) {
+		respondWithError(w, http.StatusConflict, "The action wouldn't change anything, the report is still open")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Report %v %s", report.ID, status)
+	respondWithJSON(w, http.StatusOK, convertReport(report))
+}
+
+func (a *apiConfig) moderateChirp(w http.ResponseWriter, r *http.Request, moderator database.User) {
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input := moderationInput{}
+	decodeInput(w, r, &input)
+	if input.Action != modHideChirp && input.Action != modUnhideChirp {
+		respondWithError(w, http.StatusBadRequest, `Action must be "hide_chirp" or "unhide_chirp"`)
+		return
+	}
+
+	chirp, err := a.dbQueries.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find chirp on database")
+		return
+	}
+
+	act := input.action()
+	act.ChirpID = chirp.ID
+	act.UserID = chirp.UserID
+	act.ModeratorID = moderatorID
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		if err := applyModerationAction(r.Context(), q, act); err != nil {
+			return err
+		}
+		return a.auditModeration(q, r, act)
+	})
+	if errors.Is(err, errNoChange) {
+		respondWithError(w, http.StatusConflict, "The chirp is already in that state")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Moderation: %s on chirp %v", act.Kind, chirp.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) moderateUser(w http.ResponseWriter, r *http.Request, moderator database.User) {
+	moderatorID := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input := moderationInput{}
+	decodeInput(w, r, &input)
+	if input.Action == modHideChirp || input.Action == modUnhideChirp {
+		respondWithError(w, http.StatusBadRequest, "Chirp actions need a chirp, not a user")
+		return
+	}
+	if err := input.check(false); err != nil {
+		respondWithValidationError(w, err)
+		return
+	}
+
+	user, err := a.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user on database")
+		return
+	}
+
+	act := input.action()
+	act.UserID = user.ID
+	act.ModeratorID = moderatorID
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		if err := applyModerationAction(r.Context(), q, act); err != nil {
+			return err
+		}
+		return a.auditModeration(q, r, act)
+	})
+	if errors.Is(err, errNoChange) {
+		respondWithError(w, http.StatusConflict, "The user is already in that state")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Moderation: %s on user %v", act.Kind, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) getModerationLog(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			respondWithError(w, http.StatusBadRequest, "Limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := a.dbQueries.ListModerationLog(r.Context(), int32(limit))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type logResponse struct {
+		Id uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		ModeratorId *uuid.UUID `json:"moderator_id"`
+		Action string `json:"action"`
+		TargetUserId *uuid.UUID `json:"target_user_id"`
+		TargetChirpId *uuid.UUID `json:"target_chirp_id"`
+		ReportId *uuid.UUID `json:"report_id"`
+		Note string `json:"note"`
+	}
+	optional := func(id uuid.NullUUID) *uuid.UUID {
+		if !id.Valid {
+			return nil
+		}
+		return &id.UUID
+	}
+
+	logData := []logResponse{}
+	for _, entry := range entries {
+		logData = append(logData, logResponse{
+			Id: entry.ID,
+			CreatedAt: entry.CreatedAt,
+			ModeratorId: optional(entry.ModeratorID),
+			Action: entry.Action,
+			TargetUserId: optional(entry.TargetUserID),
+			TargetChirpId: optional(entry.TargetChirpID),
+			ReportId: optional(entry.ReportID),
+			Note: entry.Note,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, logData)
+}
+
+func (a *apiConfig) listWarnings(w http.ResponseWriter, r *http.Request, user database.User) {
+	userID := user.ID
+
+	warnings, err := a.dbQueries.ListWarningsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type warningResponse struct {
+		Id uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Message string `json:"message"`
+	}
+	warningsData := []warningResponse{}
+	for _, warning := range warnings {
+		warningsData = append(warningsData, warningResponse{
+			Id: warning.ID,
+			CreatedAt: warning.CreatedAt,
+			Message: warning.Message,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, warningsData)
+}
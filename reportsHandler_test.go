@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// fieldCodes lists the "field/code" pairs of a validation error.
+func fieldCodes(err error) []string {
+	var errs validate.Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	var out []string
+	for _, e := range errs {
+		out = append(out, e.Field + "/" + e.Code)
+	}
+	return out
+}
+
+func TestModerationInputCheck(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	cases := []struct {
+		name string
+		input moderationInput
+		allowNone bool
+		want string
+	}{
+		{name: "no action when closing a report", allowNone: true},
+		{name: "no action", want: "action/required"},
+		{name: "unknown action", input: moderationInput{Action: "ban_forever"}, want: "action/invalid"},
+		{name: "hide", input: moderationInput{Action: modHideChirp}},
+		{name: "shadow ban", input: moderationInput{Action: modShadowBanUser}},
+		{name: "suspend", input: moderationInput{Action: modSuspendUser, SuspendedUntil: &future}},
+		{name: "suspend without end", input: moderationInput{Action: modSuspendUser}, want: "suspended_until/invalid"},
+		{name: "suspend into the past", input: moderationInput{Action: modSuspendUser, SuspendedUntil: &past}, want: "suspended_until/invalid"},
+		{name: "warn", input: moderationInput{Action: modWarnUser, Message: "Be nice"}},
+		{name: "warn without message", input: moderationInput{Action: modWarnUser}, want: "message/required"},
+	}
+
+	for _, c := range cases {
+		err := c.input.check(c.allowNone)
+		got := strings.Join(fieldCodes(err), ",")
+		if c.want == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCheckReport(t *testing.T) {
+	reporter := uuid.New()
+	reported := uuid.New()
+
+	if err := checkReport(reporter, reported, "spam", "buy my stuff"); err != nil {
+		t.Errorf("valid report rejected: %v", err)
+		return
+	}
+
+	cases := []struct {
+		name string
+		reported uuid.UUID
+		reason string
+		details string
+		want string
+	}{
+		{name: "unknown reason", reported: reported, reason: "boring", want: "reason/invalid"},
+		{name: "missing reason", reported: reported, want: "reason/invalid"},
+		{name: "self report", reported: reporter, reason: "spam", want: "target/self_report"},
+		{name: "details too long", reported: reported, reason: "other", details: strings.Repeat("a", 1001), want: "details/too_long"},
+		{name: "several errors", reported: reporter, reason: "boring", want: "reason/invalid,target/self_report"},
+	}
+	for _, c := range cases {
+		got := strings.Join(fieldCodes(checkReport(reporter, c.reported, c.reason, c.details)), ",")
+		if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+
+	// 1000 emoji are 4000 bytes but still 1000 characters.
+	if err := checkReport(reporter, reported, "other", strings.Repeat("🐦", 1000)); err != nil {
+		t.Errorf("details should be counted in characters, not bytes: %v", err)
+	}
+}
+
+// fileReport has reporter report a new chirp by author and returns the
+// report's id.
+func (s *testServer) fileReport(author, reporter testLogin) (uuid.UUID, error) {
+	w := s.request("POST", "/api/chirps", author.Token, map[string]string{"body": "Say my name"})
+	if w.Code != http.StatusCreated {
+		return uuid.Nil, fmt.Errorf("couldn't chirp: %d %s", w.Code, w.Body.String())
+	}
+	chirp := struct {
+		Id uuid.UUID `json:"id"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &chirp); err != nil {
+		return uuid.Nil, err
+	}
+	w = s.request("POST", "/api/chirps/" + chirp.Id.String() + "/report", reporter.Token, map[string]string{"reason": "spam"})
+	if w.Code != http.StatusCreated {
+		return uuid.Nil, fmt.Errorf("couldn't report: %d %s", w.Code, w.Body.String())
+	}
+	report := reportResponse{}
+	return report.Id, json.Unmarshal(w.Body.Bytes(), &report)
+}
+
+func TestReportsNeedPermission(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	user, err := s.signUp("jesse@breakingbad.com", "yeah science bitch", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	moderator, err := s.signUp("hank@dea.gov", "jesus marie they're minerals", "moderator")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	if w := s.request("GET", "/admin/reports", user.Token, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected a user to be refused the reports, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("GET", "/admin/reports", moderator.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("expected a moderator to see the reports, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	// Roles are looked up on every request, so a demotion holds for tokens
+	// issued before it.
+	if _, err := s.api.dbQueries.SetUserRole(context.Background(), database.SetUserRoleParams{ID: moderator.Id, Role: "user"}); err != nil {
+		t.Errorf("couldn't demote the moderator: %v", err)
+		return
+	}
+	if w := s.request("GET", "/admin/reports", moderator.Token, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected a demoted moderator to be refused the reports, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestActingOnReportNeedsModeratePermission(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	// A role that may handle reports but not moderate content.
+	_, err = s.api.db.Exec(`INSERT INTO roles (name, description) VALUES ('triager', 'Sorts reports');
+		INSERT INTO role_permissions (role, permission) VALUES ('triager', 'reports:manage')`)
+	if err != nil {
+		t.Errorf("couldn't create the role: %v", err)
+		return
+	}
+
+	walt, err := s.signUp("walt@breakingbad.com", "say my name heisenberg", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	jesse, err := s.signUp("jesse@breakingbad.com", "yeah science bitch", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	triager, err := s.signUp("gomez@dea.gov", "the blue stuff is back", "triager")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	moderator, err := s.signUp("hank@dea.gov", "jesus marie they're minerals", "moderator")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+
+	reportID, err := s.fileReport(walt, jesse)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	resolve := "/admin/reports/" + reportID.String() + "/resolve"
+	hide := map[string]string{"action": modHideChirp}
+
+	if w := s.request("POST", resolve, triager.Token, hide); w.Code != http.StatusForbidden {
+		t.Errorf("expected acting on a report without content:moderate to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("POST", resolve, moderator.Token, hide); w.Code != http.StatusOK {
+		t.Errorf("expected a moderator to act on the report, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	reportID, err = s.fileReport(walt, jesse)
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	if w := s.request("POST", "/admin/reports/" + reportID.String() + "/resolve", triager.Token, map[string]string{"note": "Fine"}); w.Code != http.StatusOK {
+		t.Errorf("expected closing a report without an action to be allowed, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Permissions guarding the admin routes. Which roles hold them lives in the
+// role_permissions table.
+const (
+	permMetricsRead = "metrics:read"
+	permSystemReset = "system:reset"
+	permReportsManage = "reports:manage"
+	permContentModerate = "content:moderate"
+	permModerationLogRead = "moderation_log:read"
+	permBannedTermsManage = "banned_terms:manage"
+	permLockoutsManage = "lockouts:manage"
+	permRolesManage = "roles:manage"
+	permUsersManage = "users:manage"
+	permAuditRead = "audit:read"
+)
+
+const roleAdmin = "admin"
+
+var errLastAdmin = errors.New("Chirpy needs at least one admin, make someone else admin first")
+
+// requirePermission lets a request through to next only for signed in users
+// whose role holds permission. Like account management, it only takes
+// unrestricted tokens from a login.
+func (a *apiConfig) requirePermission(permission string, next authedHandler) http.HandlerFunc {
+	return a.requireAuth("", func(w http.ResponseWriter, r *http.Request, user database.User) {
+		if !a.checkPermission(w, r, user, permission) {
+			return
+		}
+		next(w, r, user)
+	})
+}
+
+// checkPermission is requirePermission for handlers that need more than one
+// permission for some requests. It writes the error response itself.
+func (a *apiConfig) checkPermission(w http.ResponseWriter, r *http.Request, user database.User, permission string) bool {
+	allowed, err := a.dbQueries.RoleHasPermission(r.Context(), database.RoleHasPermissionParams{
+		Role: user.Role,
+		Permission: permission,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !allowed {
+		log.Printf("User %v (%s) was refused %s on %s", user.ID, user.Role, permission, r.URL.Path)
+		respondWithError(w, http.StatusForbidden, "You don't have permission to do this")
+		return false
+	}
+	return true
+}
+
+type roleResponse struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func (a *apiConfig) listRoles(w http.ResponseWriter, r *http.Request, user database.User) {
+	roles, err := a.dbQueries.ListRoles(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	grants, err := a.dbQueries.ListRolePermissions(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	permissions := map[string][]string{}
+	for _, grant := range grants {
+		permissions[grant.Role] = append(permissions[grant.Role], grant.Permission)
+	}
+	rolesData := []roleResponse{}
+	for _, role := range roles {
+		rolesData = append(rolesData, roleResponse{
+			Name: role.Name,
+			Description: role.Description,
+			Permissions: append([]string{}, permissions[role.Name]...),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, rolesData)
+}
+
+// setUserRole gives a user another role. The last admin can't be demoted, so
+// there is always someone left to assign roles.
+func (a *apiConfig) setUserRole(w http.ResponseWriter, r *http.Request, admin database.User) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	type roleInput struct {
+		Role string `json:"role"`
+	}
+	input := roleInput{}
+	decodeInput(w, r, &input)
+
+	roles, err := a.dbQueries.ListRoles(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	known := false
+	for _, role := range roles {
+		known = known || role.Name == input.Role
+	}
+	if !known {
+		respondWithError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+
+	var user database.User
+	err = a.withTx(r.Context(), func(q *database.Queries) error {
+		// Demotions of admins take turns, so two admins demoting each
+		// other can't both succeed.
+		if err := q.LockRole(r.Context(), roleAdmin); err != nil {
+			return err
+		}
+		current, err := q.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if current.Role == roleAdmin && input.Role != roleAdmin {
+			admins, err := q.CountUsersWithRole(r.Context(), roleAdmin)
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errLastAdmin
+			}
+		}
+		user, err = q.SetUserRole(r.Context(), database.SetUserRoleParams{ID: userID, Role: input.Role})
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{
+			Event: auditAdminSetRole,
+			ActorID: admin.ID,
+			UserID: user.ID,
+			Metadata: map[string]any{"old_role": current.Role, "new_role": user.Role},
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user on database")
+		return
+	}
+	if errors.Is(err, errLastAdmin) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type userRoleResponse struct {
+		Id uuid.UUID `json:"id"`
+		Email string `json:"email"`
+		Role string `json:"role"`
+	}
+	log.Printf("Admin %v made user %v %s", admin.ID, user.ID, user.Role)
+	respondWithJSON(w, http.StatusOK, userRoleResponse{Id: user.ID, Email: user.Email, Role: user.Role})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetUserRole(t *testing.T) {
+	s, done, err := newTestServer(t)
+	if err != nil {
+		t.Errorf("couldn't start the server: %v", err)
+		return
+	}
+	defer done()
+
+	gus, err := s.signUp("gus@lospolloshermanos.com", "i hide in plain sight", "admin")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	mike, err := s.signUp("mike@lospolloshermanos.com", "no more half measures", "user")
+	if err != nil {
+		t.Errorf("%v", err)
+		return
+	}
+	gusRole := "/admin/users/" + gus.Id.String() + "/role"
+	mikeRole := "/admin/users/" + mike.Id.String() + "/role"
+
+	if w := s.request("PUT", mikeRole, mike.Token, map[string]string{"role": "admin"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected a user to be refused changing roles, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("PUT", mikeRole, gus.Token, map[string]string{"role": "kingpin"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown role to be refused, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("PUT", gusRole, gus.Token, map[string]string{"role": "user"}); w.Code != http.StatusConflict {
+		t.Errorf("expected the last admin to keep their role, got %d %s", w.Code, w.Body.String())
+		return
+	}
+
+	if w := s.request("PUT", mikeRole, gus.Token, map[string]string{"role": "admin"}); w.Code != http.StatusOK {
+		t.Errorf("expected the promotion to work, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	// The new role holds right away, for the token mike already has.
+	if w := s.request("PUT", gusRole, mike.Token, map[string]string{"role": "user"}); w.Code != http.StatusOK {
+		t.Errorf("expected another admin to demote gus, got %d %s", w.Code, w.Body.String())
+		return
+	}
+	if w := s.request("GET", "/admin/roles", gus.Token, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected the demoted admin to be refused, got %d %s", w.Code, w.Body.String())
+	}
+}
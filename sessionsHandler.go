@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// clientIP is the address the request came from. X-Forwarded-For is only
+// believed when TRUST_PROXY is set, otherwise any client could pick its IP.
+func (a *apiConfig) clientIP(r *http.Request) string {
+	if a.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type sessionResponse struct {
+	Id uuid.UUID `json:"id"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string `json:"user_agent"`
+	Ip string `json:"ip"`
+}
+
+func toSessionResponses(sessions []database.ListSessionsRow) []sessionResponse {
+	sessionsData := []sessionResponse{}
+	for _, session := range sessions {
+		sessionsData = append(sessionsData, sessionResponse{
+			Id: session.FamilyID,
+			SignedInAt: session.SignedInAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt: session.ExpiresAt,
+			UserAgent: session.UserAgent,
+			Ip: session.Ip,
+		})
+	}
+	return sessionsData
+}
+
+// A session is everything issued from one login: the refresh token family
+// and the access tokens minted from it. Its ID is the family ID.
+func (a *apiConfig) listSessions(w http.ResponseWriter, r *http.Request, user database.User) {
+	sessions, err := a.dbQueries.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, toSessionResponses(sessions))
+}
+
+// revokeSession logs one session out. Its refresh tokens are revoked, and
+// the access tokens it issued are refused from then on, since they carry
+// the session ID.
+func (a *apiConfig) revokeSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revoked, err := a.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find an active session with that id")
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditSessionRevoked,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"session_id": sessionID},
+	})
+	log.Printf("Session %v revoked", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logOutEverywhere revokes every refresh token and personal access token of
+// the user, and bumps their token version so outstanding access tokens stop
+// working too. It returns how many refresh tokens were revoked.
+func logOutEverywhere(ctx context.Context, q *database.Queries, userID uuid.UUID) (int64, error) {
+	revoked, err := q.RevokeAllRefreshTokens(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := q.DeleteAllPersonalAccessTokens(ctx, userID); err != nil {
+		return 0, err
+	}
+	return revoked, q.BumpTokenVersion(ctx, userID)
+}
+
+// wipeCredentials takes every way into the account away from whoever holds
+// it: the password becomes unusableHash, two-factor authentication, recovery
+// codes, passkeys, linked identities and login links are removed, and the
+// user is logged out everywhere with logOutEverywhere.
+func wipeCredentials(ctx context.Context, q *database.Queries, userID uuid.UUID, unusableHash string) error {
+	if _, err := q.UpdatePassword(ctx, database.UpdatePasswordParams{ID: userID, HashedPassword: unusableHash}); err != nil {
+		return err
+	}
+	if err := q.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.DeleteAllWebAuthnCredentials(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.DeleteUserIdentities(ctx, userID); err != nil {
+		return err
+	}
+	if err := q.DeleteMagicLinks(ctx, userID); err != nil {
+		return err
+	}
+	_, err := logOutEverywhere(ctx, q, userID)
+	return err
+}
+
+// revokeAllSessions logs the user out everywhere with logOutEverywhere,
+// including the session of this request.
+func (a *apiConfig) revokeAllSessions(w http.ResponseWriter, r *http.Request, user database.User) {
+	err := a.withTx(r.Context(), func(q *database.Queries) error {
+		revoked, err := logOutEverywhere(r.Context(), q, user.ID)
+		if err != nil {
+			return err
+		}
+		return a.appendAudit(q, r, auditEvent{
+			Event: auditSessionsRevoked,
+			ActorID: user.ID,
+			UserID: user.ID,
+			Metadata: map[string]any{"refresh_tokens_revoked": revoked},
+		})
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("User %v logged out everywhere", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
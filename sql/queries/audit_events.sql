@@ -0,0 +1,34 @@
+-- name: AppendAuditEvent :exec
+INSERT INTO audit_events (id, created_at, event, actor_id, user_id, ip, user_agent, metadata)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(event)::text IS NULL OR event = sqlc.narg(event))
+	AND (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+	AND (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+	AND (sqlc.narg(ip)::text IS NULL OR ip = sqlc.narg(ip))
+	AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+	AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: ListUserAuditEvents :many
+SELECT * FROM audit_events
+WHERE user_id = $1
+	AND event NOT LIKE 'moderation.%'
+	AND (sqlc.narg(event)::text IS NULL OR event = sqlc.narg(event))
+	AND (sqlc.narg(ip)::text IS NULL OR ip = sqlc.narg(ip))
+	AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+	AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_results);
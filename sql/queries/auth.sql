@@ -1,25 +1,85 @@
 -- name: RegisterRefreshToken :one
 INSERT INTO refresh_tokens (
-	token,
+	id,
+	token_hash,
 	created_at,
 	updated_at,
 	user_id,
-	expires_at
+	expires_at,
+	family_id,
+	user_agent,
+	ip,
+	last_used_at,
+	client_id,
+	scope
 )
 VALUES (
 	$1,
+	$2,
 	NOW(),
 	NOW(),
-	$2,
-	$3
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	NOW(),
+	$8,
+	$9
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens 
-WHERE token = $1;
+WHERE id = $1;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE id = $1
+FOR UPDATE;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
+WHERE id = $1;
+
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE id = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT
+	family_id,
+	user_agent,
+	ip,
+	last_used_at,
+	expires_at,
+	(
+		SELECT MIN(first.created_at) FROM refresh_tokens first
+		WHERE first.family_id = refresh_tokens.family_id
+	)::timestamp AS signed_in_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: SessionIsActive :one
+SELECT EXISTS (
+	SELECT 1 FROM refresh_tokens
+	WHERE family_id = $1 AND revoked_at IS NULL
+);
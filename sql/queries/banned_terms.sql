@@ -0,0 +1,27 @@
+-- name: CreateBannedTerm :one
+INSERT INTO banned_terms (id, created_at, updated_at, term, match_type)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2
+)
+RETURNING *;
+
+-- name: ListBannedTerms :many
+SELECT * FROM banned_terms
+ORDER BY created_at;
+
+-- name: GetBannedTerm :one
+SELECT * FROM banned_terms
+WHERE id = $1;
+
+-- name: UpdateBannedTerm :one
+UPDATE banned_terms
+SET updated_at = NOW(), term = $2, match_type = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteBannedTerm :execrows
+DELETE FROM banned_terms WHERE id = $1;
@@ -10,8 +10,11 @@ VALUES (
 RETURNING *;
 
 -- name: ListChirps :many
-SELECT * FROM chirps
-ORDER BY created_at;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.hidden_at IS NULL
+	AND (NOT users.shadow_banned OR chirps.user_id = sqlc.narg('viewer_id'))
+ORDER BY chirps.created_at;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
@@ -21,6 +24,30 @@ WHERE id = $1;
 DELETE FROM chirps WHERE id = $1;
 
 -- name: ListChirpsByAuthor :many
-SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = $1
+	AND chirps.hidden_at IS NULL
+	AND (NOT users.shadow_banned OR chirps.user_id = sqlc.narg('viewer_id'))
+ORDER BY chirps.created_at;
+
+-- name: GetVisibleChirp :one
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1
+	AND chirps.hidden_at IS NULL
+	AND (NOT users.shadow_banned OR chirps.user_id = sqlc.narg('viewer_id'));
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: UnhideChirp :execrows
+UPDATE chirps
+SET hidden_at = NULL
+WHERE id = $1 AND hidden_at IS NOT NULL;
+
+-- name: CountChirpsByAuthor :one
+SELECT COUNT(*) AS total, COUNT(hidden_at) AS hidden FROM chirps
+WHERE user_id = $1;
@@ -0,0 +1,18 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (id, token_hash, created_at, user_id, email, expires_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4,
+	$5
+);
+
+-- name: GetEmailVerificationTokenForUpdate :one
+SELECT * FROM email_verification_tokens
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DeleteEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens WHERE user_id = $1;
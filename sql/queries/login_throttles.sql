@@ -0,0 +1,44 @@
+-- name: RecordLoginFailure :one
+-- A failure more than a window after the previous one counts from one again.
+-- The row stays locked until the transaction ends, so concurrent attempts
+-- are counted one after the other.
+INSERT INTO login_throttles (kind, subject, failures, last_failure_at)
+VALUES (
+	sqlc.arg(kind),
+	sqlc.arg(subject),
+	1,
+	sqlc.arg(failed_at)
+)
+ON CONFLICT (kind, subject) DO UPDATE
+SET failures = CASE
+		WHEN login_throttles.last_failure_at < sqlc.arg(window_start) THEN 1
+		ELSE login_throttles.failures + 1
+	END,
+	last_failure_at = sqlc.arg(failed_at)
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = $3
+WHERE kind = $1 AND subject = $2;
+
+-- name: ReleaseLoginAttempt :exec
+-- Takes back a failure counted ahead of an attempt that passed, and the
+-- block it applied unless a later failure has replaced it.
+UPDATE login_throttles
+SET failures = GREATEST(failures - 1, 0),
+	locked_until = CASE WHEN locked_until = sqlc.narg(reserved_lock) THEN NULL ELSE locked_until END
+WHERE kind = sqlc.arg(kind) AND subject = sqlc.arg(subject);
+
+-- name: ClearLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE kind = $1 AND subject = $2;
+
+-- name: ListLoginThrottles :many
+SELECT * FROM login_throttles
+ORDER BY last_failure_at DESC;
+
+-- name: DeleteStaleLoginThrottles :exec
+-- Rows left with no failures come from attempts that were taken back.
+DELETE FROM login_throttles
+WHERE (failures = 0 OR last_failure_at < $1) AND (locked_until IS NULL OR locked_until < $2);
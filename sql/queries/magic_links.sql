@@ -0,0 +1,18 @@
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (id, token_hash, created_at, user_id, browser_hash, expires_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4,
+	$5
+);
+
+-- name: GetMagicLinkForUpdate :one
+SELECT * FROM magic_links
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DeleteMagicLinks :exec
+DELETE FROM magic_links WHERE user_id = $1;
@@ -0,0 +1,81 @@
+-- name: CreateReport :one
+INSERT INTO reports (
+	id,
+	created_at,
+	updated_at,
+	reporter_id,
+	reported_user_id,
+	chirp_id,
+	reason,
+	details
+)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: ListReportsByStatus :many
+SELECT * FROM reports
+WHERE status = $1
+ORDER BY created_at;
+
+-- name: CloseReport :one
+UPDATE reports
+SET status = $2, updated_at = NOW(), resolved_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: CreateWarning :one
+INSERT INTO user_warnings (id, created_at, user_id, report_id, message)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3
+)
+RETURNING *;
+
+-- name: ListWarningsForUser :many
+SELECT * FROM user_warnings
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: AppendModerationLog :one
+INSERT INTO moderation_log (
+	id,
+	created_at,
+	moderator_id,
+	action,
+	target_user_id,
+	target_chirp_id,
+	report_id,
+	note
+)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+)
+RETURNING *;
+
+-- name: ListModerationLog :many
+SELECT * FROM moderation_log
+ORDER BY created_at DESC
+LIMIT $1;
@@ -0,0 +1,40 @@
+-- name: CreateMutedWord :one
+INSERT INTO muted_words (
+	id,
+	created_at,
+	updated_at,
+	user_id,
+	phrase,
+	action,
+	mute_home,
+	mute_notifications,
+	mute_search,
+	expires_at
+)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+)
+RETURNING *;
+
+-- name: ListMutedWords :many
+SELECT * FROM muted_words
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ListActiveMutedWords :many
+SELECT * FROM muted_words
+WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at;
+
+-- name: DeleteMutedWord :execrows
+DELETE FROM muted_words
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,65 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, secret_hash, created_at, owner_id, name, redirect_uris, scope)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4,
+	$5,
+	$6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+	id,
+	code_hash,
+	created_at,
+	client_id,
+	user_id,
+	redirect_uri,
+	scope,
+	code_challenge,
+	family_id,
+	expires_at
+)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	gen_random_uuid(),
+	$8
+);
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+SELECT * FROM oauth_authorization_codes
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UseOAuthAuthorizationCode :exec
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE expires_at <= NOW();
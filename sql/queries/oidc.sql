@@ -0,0 +1,43 @@
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, created_at, user_id, email, last_login_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4,
+	NOW()
+);
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $3, last_login_at = NOW()
+WHERE issuer = $1 AND subject = $2;
+
+-- name: DeleteUserIdentities :exec
+DELETE FROM user_identities
+WHERE user_id = $1;
+
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (id, created_at, nonce, code_verifier, browser_hash, expires_at)
+VALUES (
+	$1,
+	NOW(),
+	$2,
+	$3,
+	$4,
+	$5
+);
+
+-- name: TakeOIDCLogin :one
+DELETE FROM oidc_logins
+WHERE id = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLogins :exec
+DELETE FROM oidc_logins
+WHERE expires_at <= NOW();
@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (id, token_hash, created_at, user_id, expires_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	$4
+);
+
+-- name: GetPasswordResetTokenForUpdate :one
+SELECT * FROM password_reset_tokens
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens WHERE user_id = $1;
@@ -0,0 +1,28 @@
+-- name: ListRoles :many
+SELECT * FROM roles
+ORDER BY name;
+
+-- name: ListRolePermissions :many
+SELECT * FROM role_permissions
+ORDER BY role, permission;
+
+-- name: RoleHasPermission :one
+SELECT EXISTS (
+	SELECT 1 FROM role_permissions
+	WHERE role = $1 AND permission = $2
+);
+
+-- name: LockRole :exec
+SELECT name FROM roles
+WHERE name = $1
+FOR UPDATE;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET updated_at = NOW(), role = $2
+WHERE id = $1
+RETURNING *;
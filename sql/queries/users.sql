@@ -15,14 +15,79 @@ DELETE FROM users;
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
--- name: UpdateEmailAndPassword :one
+-- name: UpgradeUser :one
 UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
+SET is_chirpy_red = true
+WHERE id = $1
 RETURNING *;
 
--- name: UpgradeUser :one
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: SuspendUser :execrows
 UPDATE users
-SET is_chirpy_red = true
+SET updated_at = NOW(), suspended_until = $2
+WHERE id = $1 AND suspended_until IS DISTINCT FROM $2;
+
+-- name: SetShadowBanned :execrows
+UPDATE users
+SET updated_at = NOW(), shadow_banned = $2
+WHERE id = $1 AND shadow_banned <> $2;
+
+-- name: BumpTokenVersion :exec
+UPDATE users
+SET updated_at = NOW(), token_version = token_version + 1
+WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = $2, totp_enabled_at = NULL, totp_last_step = 0
+WHERE id = $1;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET updated_at = NOW(), totp_enabled_at = NOW()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET updated_at = NOW(), totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: UpdatePassword :one
+UPDATE users
+SET updated_at = NOW(), hashed_password = $2
 WHERE id = $1
 RETURNING *;
+
+-- name: VerifyEmail :one
+UPDATE users
+SET updated_at = NOW(), email = $2, email_verified_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: RehashPassword :execrows
+-- Upgrades the hash without touching updated_at. It does nothing if the
+-- password was changed since old_hash was read.
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hash);
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE sqlc.arg(pattern)
+ORDER BY email
+LIMIT sqlc.arg(max_results);
+
+-- name: SetChirpyRed :execrows
+UPDATE users
+SET updated_at = NOW(), is_chirpy_red = $2
+WHERE id = $1 AND is_chirpy_red <> $2;
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1;
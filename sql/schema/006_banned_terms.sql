@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE banned_terms (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	term TEXT NOT NULL,
+	match_type TEXT NOT NULL CHECK (match_type IN ('word', 'substring', 'regex')),
+	UNIQUE (term, match_type)
+);
+
+INSERT INTO banned_terms (id, created_at, updated_at, term, match_type)
+VALUES
+	(gen_random_uuid(), NOW(), NOW(), 'kerfuffle', 'word'),
+	(gen_random_uuid(), NOW(), NOW(), 'sharbert', 'word'),
+	(gen_random_uuid(), NOW(), NOW(), 'fornax', 'word');
+
+-- +goose Down
+DROP TABLE banned_terms;
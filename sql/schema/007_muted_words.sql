@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE muted_words (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	phrase TEXT NOT NULL,
+	action TEXT NOT NULL DEFAULT 'hide' CHECK (action IN ('hide', 'collapse')),
+	mute_home BOOLEAN NOT NULL DEFAULT true,
+	mute_notifications BOOLEAN NOT NULL DEFAULT true,
+	mute_search BOOLEAN NOT NULL DEFAULT true,
+	expires_at TIMESTAMP
+);
+
+CREATE INDEX muted_words_user_id_idx ON muted_words (user_id);
+
+-- +goose Down
+DROP TABLE muted_words;
@@ -0,0 +1,63 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE reports (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	reported_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+	reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'self_harm', 'misinformation', 'impersonation', 'other')),
+	details TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+	resolved_at TIMESTAMP
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+CREATE TABLE user_warnings (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	report_id UUID REFERENCES reports(id) ON DELETE SET NULL,
+	message TEXT NOT NULL
+);
+
+-- The moderation log deliberately has no foreign keys: entries must outlive
+-- the users, chirps and reports they mention.
+CREATE TABLE moderation_log (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	moderator_id UUID,
+	action TEXT NOT NULL,
+	target_user_id UUID,
+	target_chirp_id UUID,
+	report_id UUID,
+	note TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION moderation_log_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'moderation_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER moderation_log_no_update
+BEFORE UPDATE OR DELETE ON moderation_log
+FOR EACH ROW EXECUTE FUNCTION moderation_log_immutable();
+
+CREATE TRIGGER moderation_log_no_truncate
+BEFORE TRUNCATE ON moderation_log
+FOR EACH STATEMENT EXECUTE FUNCTION moderation_log_immutable();
+
+-- +goose Down
+DROP TABLE moderation_log;
+DROP FUNCTION moderation_log_immutable;
+DROP TABLE user_warnings;
+DROP TABLE reports;
+ALTER TABLE users DROP COLUMN suspended_until;
+ALTER TABLE chirps DROP COLUMN hidden_at;
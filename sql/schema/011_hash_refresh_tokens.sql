@@ -0,0 +1,23 @@
+-- +goose Up
+-- Tokens become <16 character selector><verifier>; only the selector and a
+-- SHA-256 digest of the verifier are kept. Existing tokens are split the same
+-- way so current sessions stay valid.
+ALTER TABLE refresh_tokens ADD COLUMN id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN token_hash TEXT;
+
+UPDATE refresh_tokens SET
+	id = substr(token, 1, 16),
+	token_hash = encode(sha256(convert_to(substr(token, 17), 'UTF8')), 'hex'),
+	replaced_by = substr(replaced_by, 1, 16);
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ALTER COLUMN id SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens ADD PRIMARY KEY (id);
+
+-- +goose Down
+-- The plaintext tokens can't be recovered, everyone has to log in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+ALTER TABLE refresh_tokens RENAME COLUMN id TO token;
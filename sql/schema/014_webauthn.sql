@@ -0,0 +1,30 @@
+-- +goose Up
+-- credential holds the whole WebAuthn credential (public key, flags, sign
+-- count, transports) as JSON; credential_id is pulled out to look it up.
+CREATE TABLE webauthn_credentials (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	credential_id BYTEA NOT NULL UNIQUE,
+	credential JSONB NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	last_used_at TIMESTAMP
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- A ceremony lives between its begin and finish requests. Login ceremonies
+-- have no user: the passkey picked in the browser says who it is.
+CREATE TABLE webauthn_ceremonies (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL CHECK (kind IN ('register', 'login')),
+	session JSONB NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webauthn_ceremonies;
+DROP TABLE webauthn_credentials;
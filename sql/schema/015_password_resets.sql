@@ -0,0 +1,16 @@
+-- +goose Up
+-- Reset tokens are split like refresh tokens: id is the selector, token_hash
+-- the SHA-256 digest of the verifier. A successful reset deletes every token
+-- of the user, so each can be used once.
+CREATE TABLE password_reset_tokens (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
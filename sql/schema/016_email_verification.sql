@@ -0,0 +1,21 @@
+-- +goose Up
+-- Accounts created before verification existed start unverified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- A token proves the user can read mail sent to email: their current address
+-- after signing up, or the new one when they change it. The change is only
+-- made once the token is used.
+CREATE TABLE email_verification_tokens (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Failed logins are counted per account (subject is the lowercased email,
+-- whether or not an account has it) and per client IP.
+CREATE TABLE login_throttles (
+	kind TEXT NOT NULL CHECK (kind IN ('account', 'ip')),
+	subject TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	PRIMARY KEY (kind, subject)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
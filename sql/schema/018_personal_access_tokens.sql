@@ -0,0 +1,19 @@
+-- +goose Up
+-- Personal access tokens are split like refresh tokens: id is the selector,
+-- token_hash the SHA-256 digest of the verifier. scope is space separated,
+-- as in access tokens.
+CREATE TABLE personal_access_tokens (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
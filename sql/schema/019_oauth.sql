@@ -0,0 +1,44 @@
+-- +goose Up
+-- Third-party apps registered by users. id is the client_id; confidential
+-- clients have a secret split like refresh tokens, with the client_id as its
+-- selector, public clients have none and rely on PKCE. redirect_uris and
+-- scope are space separated.
+CREATE TABLE oauth_clients (
+	id TEXT PRIMARY KEY,
+	secret_hash TEXT,
+	created_at TIMESTAMP NOT NULL,
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	redirect_uris TEXT NOT NULL,
+	scope TEXT NOT NULL
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+
+-- Authorization codes are split like refresh tokens. Used codes are kept
+-- until they expire so that replaying one revokes the tokens it was traded
+-- for, which make up family_id.
+CREATE TABLE oauth_authorization_codes (
+	id TEXT PRIMARY KEY,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	family_id UUID NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+-- Refresh tokens of a client only work for that client, and only carry the
+-- scope the user agreed to.
+ALTER TABLE refresh_tokens ADD COLUMN client_id TEXT REFERENCES oauth_clients(id) ON DELETE CASCADE;
+ALTER TABLE refresh_tokens ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN scope;
+ALTER TABLE refresh_tokens DROP COLUMN client_id;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Accounts at an external OpenID Connect provider that sign in as a user.
+-- The provider names an account with (issuer, subject); email is the
+-- address it had when it was linked.
+CREATE TABLE user_identities (
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	last_login_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- A login lives between sending the user to the provider and getting them
+-- back. id is the state parameter; browser_hash ties it to the browser that
+-- started it.
+CREATE TABLE oidc_logins (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	browser_hash TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_logins;
+DROP TABLE user_identities;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Login links are split like refresh tokens. browser_hash ties a link to
+-- the browser that asked for it, so a forwarded link can't be used
+-- elsewhere. Logging in deletes every link of the user.
+CREATE TABLE magic_links (
+	id TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	browser_hash TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX magic_links_user_id_idx ON magic_links (user_id);
+
+-- +goose Down
+DROP TABLE magic_links;
@@ -0,0 +1,56 @@
+-- +goose Up
+-- Every user has one role; what a role may do is the set of permissions
+-- granted to it. The code checks permissions, never role names, so roles
+-- can be reshaped here without touching it.
+CREATE TABLE roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE permissions (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions (
+	role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+	('user', 'Uses Chirpy'),
+	('moderator', 'Handles reports and moderates content'),
+	('admin', 'Runs Chirpy');
+
+INSERT INTO permissions (name, description) VALUES
+	('metrics:read', 'See the site metrics'),
+	('system:reset', 'Delete every user on a development server'),
+	('reports:manage', 'List, resolve and dismiss reports'),
+	('content:moderate', 'Hide chirps and warn, suspend or shadow ban users'),
+	('moderation_log:read', 'Read the moderation log'),
+	('banned_terms:manage', 'Manage the banned terms'),
+	('lockouts:manage', 'See and clear login lockouts'),
+	('roles:manage', 'Assign roles to users');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('moderator', 'reports:manage'),
+	('moderator', 'content:moderate'),
+	('moderator', 'moderation_log:read'),
+	('moderator', 'banned_terms:manage'),
+	('admin', 'metrics:read'),
+	('admin', 'system:reset'),
+	('admin', 'reports:manage'),
+	('admin', 'content:moderate'),
+	('admin', 'moderation_log:read'),
+	('admin', 'banned_terms:manage'),
+	('admin', 'lockouts:manage'),
+	('admin', 'roles:manage');
+
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' REFERENCES roles(name);
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN role;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
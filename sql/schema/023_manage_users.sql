@@ -0,0 +1,9 @@
+-- +goose Up
+INSERT INTO permissions (name, description) VALUES
+	('users:manage', 'Look up accounts, reset their password, end their sessions, change Chirpy Red and delete them');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'users:manage');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'users:manage';
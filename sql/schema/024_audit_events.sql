@@ -0,0 +1,47 @@
+-- +goose Up
+-- Security-relevant events, for admins and for users looking at their own
+-- account. user_id is the account an event is about, actor_id who caused
+-- it when that was someone else or someone signed in. Like the moderation
+-- log, events have no foreign keys, so they outlive the accounts they
+-- mention, and can't be changed once written.
+CREATE TABLE audit_events (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	event TEXT NOT NULL,
+	actor_id UUID,
+	user_id UUID,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	metadata JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, created_at);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_no_update
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_immutable();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_immutable();
+
+INSERT INTO permissions (name, description) VALUES
+	('audit:read', 'Read the audit log of security events');
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'audit:read');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_immutable;
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/NHMosko/chirpy/internal/auth"
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/mailer"
+	"github.com/NHMosko/chirpy/internal/moderation"
+	"github.com/NHMosko/chirpy/internal/passkey"
+	"github.com/NHMosko/chirpy/internal/throttle"
+	"github.com/NHMosko/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// testServer is chirpy running on its own schema of the database at
+// TEST_DB_URL, for tests of whole flows through the handlers.
+type testServer struct {
+	api *apiConfig
+	handler http.Handler
+	mail *mailer.Memory
+}
+
+// newTestServer creates a schema with every migration applied and a server
+// using it. Tests calling it are skipped when TEST_DB_URL isn't set. The
+// returned function drops the schema again.
+func newTestServer(t *testing.T) (*testServer, func(), error) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL isn't set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	schema := "chirpy_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		return nil, nil, err
+	}
+	db, err := sql.Open("postgres", withSearchPath(dbURL, schema))
+	if err != nil {
+		admin.Close()
+		return nil, nil, err
+	}
+	done := func() {
+		db.Close()
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't drop schema %s: %v\n", schema, err)
+		}
+		admin.Close()
+	}
+
+	migrations, err := filepath.Glob(filepath.Join("sql", "schema", "*.sql"))
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	for _, path := range migrations {
+		migration, err := os.ReadFile(path)
+		if err != nil {
+			done()
+			return nil, nil, err
+		}
+		up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			done()
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	passwordParams := auth.PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1}
+	dummyPasswordHash, err := auth.HashPassword(uuid.NewString(), passwordParams)
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	passkeys, err := passkey.New(passkey.Config{
+		RPID: "localhost",
+		RPDisplayName: "Chirpy",
+		Origins: []string{"http://localhost:8080"},
+	})
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	magicLinkURL, _ := url.Parse("http://localhost:8080/app/login/magic-link")
+
+	mail := &mailer.Memory{}
+	a := &apiConfig{
+		db: db,
+		dbQueries: database.New(db),
+		platform: "dev",
+		jwtKeys: auth.NewHMACKeySet("test secret"),
+		tokenConfig: auth.DefaultTokenConfig(),
+		passkeys: passkeys,
+		mailer: mail,
+		magicLinkURL: magicLinkURL,
+		polkaKey: "test polka key",
+		accountThrottle: throttle.DefaultAccountPolicy(),
+		ipThrottle: throttle.DefaultIPPolicy(),
+		dummyPasswordHash: dummyPasswordHash,
+		chirpPolicy: validate.DefaultChirpPolicy(),
+		passwordPolicy: validate.DefaultPasswordPolicy(),
+		passwordParams: passwordParams,
+	}
+	a.bannedTerms = moderation.NewCache(a.loadBannedTerms)
+
+	return &testServer{api: a, handler: a.routes("."), mail: mail}, done, nil
+}
+
+// withSearchPath points the connections of dbURL, in either URL or key=value
+// form, at schema.
+func withSearchPath(dbURL, schema string) string {
+	if strings.HasPrefix(dbURL, "postgres://") || strings.HasPrefix(dbURL, "postgresql://") {
+		u, err := url.Parse(dbURL)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dbURL + " search_path=" + schema
+}
+
+// newTestRequest makes a request with a JSON body, when there is one, and
+// token as the bearer token, when there is one.
+func newTestRequest(method, path, token string, body any) *http.Request {
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewReader(encoded)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer " + token)
+	}
+	return r
+}
+
+func (s *testServer) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+func (s *testServer) request(method, path, token string, body any) *httptest.ResponseRecorder {
+	return s.serve(newTestRequest(method, path, token, body))
+}
+
+type testLogin struct {
+	Id uuid.UUID `json:"id"`
+	Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// login logs in with a password.
+func (s *testServer) login(email, password string) (testLogin, error) {
+	session := testLogin{}
+	w := s.request("POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	if w.Code != http.StatusOK {
+		return session, fmt.Errorf("login of %s: %d %s", email, w.Code, w.Body.String())
+	}
+	return session, json.Unmarshal(w.Body.Bytes(), &session)
+}
+
+// signUp creates an account with role and logs it in.
+func (s *testServer) signUp(email, password, role string) (testLogin, error) {
+	w := s.request("POST", "/api/users", "", map[string]string{"email": email, "password": password})
+	if w.Code != http.StatusCreated {
+		return testLogin{}, fmt.Errorf("sign up of %s: %d %s", email, w.Code, w.Body.String())
+	}
+	session, err := s.login(email, password)
+	if err != nil || role == "user" {
+		return session, err
+	}
+	_, err = s.api.dbQueries.SetUserRole(context.Background(), database.SetUserRoleParams{ID: session.Id, Role: role})
+	return session, err
+}
+
+// mailed waits for the work in the background to finish and counts the
+// emails to to with subject.
+func (s *testServer) mailed(to, subject string) int {
+	s.api.background.Wait()
+	sent := 0
+	for _, msg := range s.mail.Messages() {
+		if msg.To == to && msg.Subject == subject {
+			sent++
+		}
+	}
+	return sent
+}
+
+var mailedTokenPattern = regexp.MustCompile(`chirpy_[a-z]+_[0-9a-f]+`)
+
+// mailedToken waits for the work in the background to finish and returns
+// the token with prefix in the latest email to to, or "" when there is none.
+func (s *testServer) mailedToken(to, prefix string) string {
+	s.api.background.Wait()
+	messages := s.mail.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		for _, token := range mailedTokenPattern.FindAllString(messages[i].Body, -1) {
+			if strings.HasPrefix(token, prefix) {
+				return token
+			}
+		}
+	}
+	return ""
+}
@@ -1,25 +1,33 @@
 package main
 
 import (
-	"slices"
-	"strings"
+	"context"
+
+	"github.com/NHMosko/chirpy/internal/moderation"
 )
 
-func cleanWords(body string) string {
-	badWords := []string{"kerfuffle", "sharbert", "fornax"}
-	words := strings.Split(body, " ")
-	out := ""
-	for i, word := range words {
-		if slices.Contains(badWords, strings.ToLower(word)) {
-			out += "****"
-		} else {
-			out += word
-		}
-		
-		if i != len(words) - 1 {
-			out += " "
-		}
+// cleanWords masks every banned term in body using the cached filter built
+// from the banned_terms table.
+func (a *apiConfig) cleanWords(ctx context.Context, body string) (string, error) {
+	filter, err := a.bannedTerms.Filter(ctx)
+	if err != nil {
+		return "", err
 	}
+	return filter.Clean(body), nil
+}
 
-	return out
+func (a *apiConfig) loadBannedTerms(ctx context.Context) ([]moderation.Rule, error) {
+	terms, err := a.dbQueries.ListBannedTerms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]moderation.Rule, 0, len(terms))
+	for _, term := range terms {
+		rules = append(rules, moderation.Rule{
+			Term: term.Term,
+			Match: moderation.MatchType(term.MatchType),
+		})
+	}
+	return rules, nil
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/NHMosko/chirpy/internal/database"
+	"github.com/NHMosko/chirpy/internal/passkey"
+	"github.com/google/uuid"
+)
+
+// webauthnCeremonyTTL is how long the browser has between the begin and
+// finish requests of a ceremony.
+const webauthnCeremonyTTL = 5 * time.Minute
+
+type ceremonyResponse struct {
+	CeremonyId uuid.UUID `json:"ceremony_id"`
+	Options any `json:"options"`
+}
+
+type ceremonyInput struct {
+	CeremonyId uuid.UUID `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// passkeyUser loads user's stored passkeys. The map gives the row ID of each
+// credential, keyed by credential ID.
+func passkeyUser(ctx context.Context, q *database.Queries, user database.User) (passkey.User, map[string]uuid.UUID, error) {
+	rows, err := q.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return passkey.User{}, nil, err
+	}
+	found := passkey.User{ID: user.ID, Name: user.Email}
+	ids := map[string]uuid.UUID{}
+	for _, row := range rows {
+		credential := passkey.Credential{}
+		if err := json.Unmarshal(row.Credential, &credential); err != nil {
+			return passkey.User{}, nil, err
+		}
+		found.Credentials = append(found.Credentials, credential)
+		ids[string(row.CredentialID)] = row.ID
+	}
+	return found, ids, nil
+}
+
+// startCeremony stores the server half of a ceremony and sends the browser
+// its options.
+func (a *apiConfig) startCeremony(w http.ResponseWriter, r *http.Request, kind string, userID uuid.NullUUID, challenge passkey.Challenge) {
+	if err := a.dbQueries.DeleteExpiredWebAuthnCeremonies(r.Context()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ceremony, err := a.dbQueries.CreateWebAuthnCeremony(r.Context(), database.CreateWebAuthnCeremonyParams{
+		UserID: userID,
+		Kind: kind,
+		Session: challenge.Session,
+		ExpiresAt: time.Now().UTC().Add(webauthnCeremonyTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ceremonyResponse{CeremonyId: ceremony.ID, Options: challenge.Options})
+}
+
+// takeCeremony fetches and deletes a ceremony, so every challenge can be
+// answered once.
+func (a *apiConfig) takeCeremony(w http.ResponseWriter, r *http.Request, id uuid.UUID, kind string) (database.WebauthnCeremony, bool) {
+	ceremony, err := a.dbQueries.TakeWebAuthnCeremony(r.Context(), database.TakeWebAuthnCeremonyParams{
+		ID: id,
+		Kind: kind,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "This ceremony has expired or was already used, please start again")
+		return database.WebauthnCeremony{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return database.WebauthnCeremony{}, false
+	}
+	return ceremony, true
+}
+
+func (a *apiConfig) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request, user database.User) {
+	pkUser, _, err := passkeyUser(r.Context(), a.dbQueries, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	challenge, err := a.passkeys.BeginRegistration(pkUser)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.startCeremony(w, r, "register", uuid.NullUUID{UUID: user.ID, Valid: true}, challenge)
+}
+
+type passkeyResponse struct {
+	Id uuid.UUID `json:"id"`
+	Name string `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func toPasskeyResponse(row database.WebauthnCredential) passkeyResponse {
+	response := passkeyResponse{
+		Id: row.ID,
+		Name: row.Name,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.LastUsedAt.Valid {
+		response.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return response
+}
+
+func (a *apiConfig) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request, user database.User) {
+	type registerInput struct {
+		ceremonyInput
+		Name string `json:"name"`
+	}
+	input := registerInput{}
+	decodeInput(w, r, &input)
+
+	ceremony, ok := a.takeCeremony(w, r, input.CeremonyId, "register")
+	if !ok {
+		return
+	}
+	if ceremony.UserID.UUID != user.ID {
+		respondWithError(w, http.StatusBadRequest, "This ceremony was started by another user")
+		return
+	}
+
+	pkUser, _, err := passkeyUser(r.Context(), a.dbQueries, user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	credential, err := a.passkeys.FinishRegistration(pkUser, ceremony.Session, input.Credential)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	row, err := a.dbQueries.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+		UserID: user.ID,
+		CredentialID: credential.ID,
+		Credential: raw,
+		Name: input.Name,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditPasskeyAdded,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"passkey_id": row.ID, "name": row.Name},
+	})
+	log.Printf("User %v registered a passkey", user.ID)
+	respondWithJSON(w, http.StatusCreated, toPasskeyResponse(row))
+}
+
+// beginPasskeyLogin needs no email: the browser offers whichever passkeys it
+// holds for Chirpy and the one picked names its user.
+func (a *apiConfig) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	challenge, err := a.passkeys.BeginLogin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.startCeremony(w, r, "login", uuid.NullUUID{}, challenge)
+}
+
+// finishPasskeyLogin checks the assertion and starts a session like a
+// password login. A passkey proves possession and user verification in one
+// step, so no TOTP code is asked for.
+func (a *apiConfig) finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	input := ceremonyInput{}
+	decodeInput(w, r, &input)
+
+	ceremony, ok := a.takeCeremony(w, r, input.CeremonyId, "login")
+	if !ok {
+		return
+	}
+
+	var user database.User
+	var rowIDs map[string]uuid.UUID
+	var lookupErr error
+	lookup := func(userID uuid.UUID) (passkey.User, error) {
+		var pkUser passkey.User
+		user, lookupErr = a.dbQueries.GetUserByID(r.Context(), userID)
+		if lookupErr == nil {
+			pkUser, rowIDs, lookupErr = passkeyUser(r.Context(), a.dbQueries, user)
+		}
+		return pkUser, lookupErr
+	}
+
+	_, credential, err := a.passkeys.FinishLogin(lookup, ceremony.Session, input.Credential)
+	if lookupErr != nil && !errors.Is(lookupErr, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, lookupErr.Error())
+		return
+	}
+	if errors.Is(err, passkey.ErrCloned) {
+		a.audit(r, auditEvent{
+			Event: auditLoginFailed,
+			UserID: user.ID,
+			Metadata: map[string]any{"method": "passkey", "reason": "cloned"},
+		})
+		log.Printf("Refused a passkey of user %v: %v", user.ID, err)
+		respondWithError(w, http.StatusUnauthorized, "Passkey login failed")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed passkey log in attempt: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Passkey login failed")
+		return
+	}
+
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = a.dbQueries.UpdateWebAuthnCredentialUse(r.Context(), database.UpdateWebAuthnCredentialUseParams{
+		ID: rowIDs[string(credential.ID)],
+		Credential: raw,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if isSuspended(user) {
+		log.Printf("Suspended user tried to log in")
+		respondSuspended(w, user)
+		return
+	}
+	a.issueSession(w, r, user, "passkey")
+}
+
+func (a *apiConfig) listPasskeys(w http.ResponseWriter, r *http.Request, user database.User) {
+	rows, err := a.dbQueries.ListWebAuthnCredentials(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	passkeysData := []passkeyResponse{}
+	for _, row := range rows {
+		passkeysData = append(passkeysData, toPasskeyResponse(row))
+	}
+	respondWithJSON(w, http.StatusOK, passkeysData)
+}
+
+func (a *apiConfig) deletePasskey(w http.ResponseWriter, r *http.Request, user database.User) {
+	credentialID, err := uuid.Parse(r.PathValue("credentialID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := a.dbQueries.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+		ID: credentialID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't find a passkey with that id")
+		return
+	}
+
+	a.audit(r, auditEvent{
+		Event: auditPasskeyRemoved,
+		ActorID: user.ID,
+		UserID: user.ID,
+		Metadata: map[string]any{"passkey_id": credentialID},
+	})
+	log.Printf("User %v removed passkey %v", user.ID, credentialID)
+	w.WriteHeader(http.StatusNoContent)
+}